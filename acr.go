@@ -0,0 +1,73 @@
+package jambo
+
+import "slices"
+
+// SetACRValues sets the list of Authentication Context Class Reference values
+// supported by the authenticator, ordered from the weakest to the strongest.
+func (s *Server) SetACRValues(values ...string) {
+	s.acrValues = values
+}
+
+// acrAtLeast reports whether the ACR value acr is as strong as min.
+// Values not listed in [Server.SetACRValues] only satisfy themselves.
+func (s *Server) acrAtLeast(acr, min string) bool {
+	if acr == min {
+		return true
+	}
+	i := slices.Index(s.acrValues, acr)
+	j := slices.Index(s.acrValues, min)
+	if i < 0 || j < 0 {
+		return false
+	}
+	return i >= j
+}
+
+// acrAccepted reports whether an authentication with the given ACR value
+// satisfies both the minimum ACR of the client and the essential "acr" claim,
+// if it was requested.
+func (s *Server) acrAccepted(conn *Connection, acr string) bool {
+	if conn.client.minimumACR != "" && !s.acrAtLeast(acr, conn.client.minimumACR) {
+		return false
+	}
+	values := essentialACRValues(conn)
+	return len(values) == 0 || slices.ContainsFunc(values, func(min string) bool {
+		return s.acrAtLeast(acr, min)
+	})
+}
+
+// requiredACR returns the ACR values sent to the authenticator in [Request.RequiredACR]:
+// the essential values of the "acr" claim that are not weaker than the minimum ACR
+// of the client, or else the minimum ACR itself.
+func (s *Server) requiredACR(conn *Connection) []string {
+	min := conn.client.minimumACR
+	var required []string
+	for _, acr := range essentialACRValues(conn) {
+		if min == "" || s.acrAtLeast(acr, min) {
+			required = append(required, acr)
+		}
+	}
+	if len(required) == 0 && min != "" {
+		required = []string{min}
+	}
+	return required
+}
+
+// essentialACRValues returns the values of the "acr" claim, if it has been requested
+// in the ID token as essential.
+func essentialACRValues(conn *Connection) []string {
+	req, ok := conn.claims.Requested(claimsTargetIDToken, "acr")
+	if !ok || req == nil || !req.Essential {
+		return nil
+	}
+	values := req.Values
+	if req.Value != nil {
+		values = append(values, req.Value)
+	}
+	var acrs []string
+	for _, v := range values {
+		if acr, ok := v.(string); ok {
+			acrs = append(acrs, acr)
+		}
+	}
+	return acrs
+}
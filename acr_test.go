@@ -0,0 +1,156 @@
+package jambo_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/cespedes/jambo"
+)
+
+// newACRTestServer returns a test server whose authenticator accepts a password ("pwd")
+// or a password and a one-time password ("mfa").  If stepUp is true, it asks for the
+// one-time password when the server asks for a stronger authentication.
+// The last request it got is stored in last.
+func newACRTestServer(t *testing.T, stepUp bool, last *jambo.Request) (*jambo.Server, *httptest.Server) {
+	t.Helper()
+	s, ts := newTestServer(t)
+	s.SetACRValues("pwd", "mfa")
+	s.SetAuthenticator(func(req *jambo.Request) jambo.Response {
+		*last = *req
+		login := req.Params["login"]
+		switch {
+		case req.Params["password"] != testPassword:
+			return jambo.Response{Type: jambo.ResponseTypeLoginFailed, Login: login}
+		case req.Params["otp"] == "123456":
+			return jambo.Response{Type: jambo.ResponseTypeLoginOK, Login: login, ACR: "mfa", AMR: []string{"pwd", "otp"}}
+		case req.StepUp != nil && stepUp:
+			return jambo.Response{Type: jambo.ResponseTypeRedirect, Redirect: "login.html", Params: map[string]string{"login": login}}
+		}
+		return jambo.Response{Type: jambo.ResponseTypeLoginOK, Login: login, ACR: "pwd", AMR: []string{"pwd"}}
+	})
+	return s, ts
+}
+
+// loginWithOTP answers the page shown after the login form, which must be the one
+// asking for a stronger authentication, with the one-time password.
+func loginWithOTP(t *testing.T, browser *http.Client, ts *httptest.Server, resp *http.Response) *http.Response {
+	t.Helper()
+	page := readBody(t, resp)
+	m := sessionRE.FindStringSubmatch(page)
+	if resp.StatusCode != http.StatusOK || m == nil {
+		t.Fatalf("login with a password: status %d; want a step-up page:\n%s", resp.StatusCode, page)
+	}
+	resp, err := browser.PostForm(ts.URL+"/oidc/auth/login", url.Values{
+		"session":  {m[1]},
+		"login":    {"alice"},
+		"password": {testPassword},
+		"otp":      {"123456"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// idTokenACR exchanges the code in the response to a login and returns the "acr"
+// and "amr" claims of the ID token.
+func idTokenACR(t *testing.T, ts *httptest.Server, resp *http.Response) (any, []any) {
+	t.Helper()
+	resp.Body.Close()
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	status, tokens := postForm(t, ts, "/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {location.Query().Get("code")},
+		"redirect_uri": {testRedirectURI},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token endpoint (redirected to %s): status %d: %v", location, status, tokens)
+	}
+	claims := jwtClaims(t, tokens["id_token"].(string))
+	amr, _ := claims["amr"].([]any)
+	return claims["acr"], amr
+}
+
+func TestACRValues(t *testing.T) {
+	var last jambo.Request
+	_, ts := newACRTestServer(t, true, &last)
+
+	resp := login(t, newBrowser(ts), ts, authParams(url.Values{"acr_values": {"mfa pwd"}}), "alice")
+	if !slices.Equal(last.ACRValues, []string{"mfa", "pwd"}) || last.RequiredACR != nil || last.StepUp != nil {
+		t.Errorf("authenticator got ACRValues %v, RequiredACR %v and StepUp %v; want [mfa pwd], none and nil", last.ACRValues, last.RequiredACR, last.StepUp)
+	}
+	// acr_values are only a preference, so a weaker authentication is accepted.
+	acr, amr := idTokenACR(t, ts, resp)
+	if acr != "pwd" || len(amr) != 1 || amr[0] != "pwd" {
+		t.Errorf("ID token has acr %v and amr %v; want pwd and [pwd]", acr, amr)
+	}
+}
+
+func TestACRStepUp(t *testing.T) {
+	var last jambo.Request
+	s, ts := newACRTestServer(t, true, &last)
+	c := s.NewClient("finance", testClientSecret)
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetMinimumACR("mfa")
+
+	tests := []struct {
+		name   string
+		params url.Values
+	}{
+		{"minimum ACR of the client", authParams(url.Values{"client_id": {"finance"}})},
+		{"essential acr claim", authParams(url.Values{"claims": {`{"id_token":{"acr":{"essential":true,"values":["mfa"]}}}`}})},
+	}
+	for _, test := range tests {
+		browser := newBrowser(ts)
+		resp := login(t, browser, ts, test.params, "alice")
+		if !slices.Equal(last.RequiredACR, []string{"mfa"}) || last.StepUp == nil || last.StepUp.ACR != "pwd" {
+			t.Errorf("%s: authenticator got RequiredACR %v and StepUp %v; want [mfa] and the pwd response", test.name, last.RequiredACR, last.StepUp)
+		}
+		resp = loginWithOTP(t, browser, ts, resp)
+		if last.StepUp != nil {
+			t.Errorf("%s: authenticator got StepUp %v with the one-time password; want nil", test.name, last.StepUp)
+		}
+		if test.name != "essential acr claim" {
+			continue // the ID token is for the test client
+		}
+		if acr, amr := idTokenACR(t, ts, resp); acr != "mfa" || len(amr) != 2 {
+			t.Errorf("%s: ID token has acr %v and amr %v; want mfa and [pwd otp]", test.name, acr, amr)
+		}
+	}
+}
+
+func TestACRUnmet(t *testing.T) {
+	var last jambo.Request
+	_, ts := newACRTestServer(t, false, &last)
+
+	params := authParams(url.Values{"claims": {`{"id_token":{"acr":{"essential":true,"value":"mfa"}}}`}})
+	resp := login(t, newBrowser(ts), ts, params, "alice")
+	resp.Body.Close()
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if location.Query().Get("error") != "unmet_authentication_requirements" {
+		t.Errorf("authenticator without step-up: redirected to %s; want unmet_authentication_requirements", location)
+	}
+}
+
+func TestACRSessionStepUp(t *testing.T) {
+	var last jambo.Request
+	_, ts := newACRTestServer(t, true, &last)
+	browser := newBrowser(ts)
+
+	// A session with a weaker authentication is not used for a request which needs a stronger one.
+	idTokenACR(t, ts, login(t, browser, ts, authParams(nil), "alice"))
+	params := authParams(url.Values{"claims": {`{"id_token":{"acr":{"essential":true,"value":"mfa"}}}`}})
+	resp := loginWithOTP(t, browser, ts, login(t, browser, ts, params, "alice"))
+	if acr, _ := idTokenACR(t, ts, resp); acr != "mfa" {
+		t.Errorf("ID token after step-up has acr %v; want mfa", acr)
+	}
+
+	// Once the session has the stronger one, it can be used.
+	location, page := authorize(t, browser, ts, params)
+	if location == nil || location.Query().Get("code") == "" {
+		t.Errorf("request with a session with acr mfa: redirected to %v; want a code without logging in:\n%s", location, page)
+	}
+}
@@ -8,21 +8,46 @@ import (
 	"net/url"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Values for the "prompt" parameter:
+const (
+	promptNone          = "none"
+	promptLogin         = "login"
+	promptConsent       = "consent"
+	promptSelectAccount = "select_account" // not supported: there is no account chooser
+)
+
+var promptValues = []string{
+	promptNone,
+	promptLogin,
+	promptConsent,
+}
+
 // openIDAuth is the handler for the Authorization endpoint ("/auth")
 func (s *Server) openIDAuth(w http.ResponseWriter, r *http.Request) {
+	params, err := s.authParams(r)
+	if err != nil {
+		s.template(w, r, "error.html", map[string]string{
+			"errorType": "Bad request",
+			"error":     err.Error(),
+		})
+		return
+	}
+
 	conn := Connection{
 		code:        rand.Text(),
-		redirectURI: r.FormValue("redirect_uri"),
-		state:       r.FormValue("state"),
-		nonce:       r.FormValue("nonce"),
-		scopes:      strings.Fields(r.FormValue("scope")),
+		redirectURI: params.Get("redirect_uri"),
+		state:       params.Get("state"),
+		nonce:       params.Get("nonce"),
+		scopes:      strings.Fields(params.Get("scope")),
 	}
 	r = s.SetConnection(r, &conn)
 
-	clientID := r.FormValue("client_id")
+	clientID := params.Get("client_id")
 	if clientID == "" {
 		s.template(w, r, "error.html", map[string]string{
 			"errorType": `Bad request`,
@@ -31,12 +56,7 @@ func (s *Server) openIDAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, c := range s.clients {
-		if c.id == clientID {
-			conn.client = c
-			break
-		}
-	}
+	conn.client = s.findClient(clientID)
 	if conn.client == nil {
 		s.template(w, r, "error.html", map[string]string{
 			"error": fmt.Sprintf(`unknown client "%s"`, clientID),
@@ -56,7 +76,8 @@ func (s *Server) openIDAuth(w http.ResponseWriter, r *http.Request) {
 	// All other scopes are optional.
 	// If a client sends an unrecognized scope, we send an error.
 	for _, scope := range conn.scopes {
-		if !slices.Contains(scopesSupported, scope) && !slices.Contains(conn.client.allowedScopes, scope) {
+		if !slices.Contains(scopesSupported, scope) && !slices.Contains(conn.client.allowedScopes, scope) &&
+			!s.allowsAPIScope(conn.client, scope) {
 			s.template(w, r, "error.html", map[string]string{
 				"errorType": "Bad request",
 				"error":     `Unrecognized scope: "` + scope + `"`,
@@ -65,10 +86,11 @@ func (s *Server) openIDAuth(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// We only support response_type = "code"
-	if r.FormValue("response_type") != "code" {
+	// The implicit and hybrid flows can only be used by the clients allowed to.
+	conn.responseType = normalizeResponseType(params.Get("response_type"))
+	if !slices.Contains(responseTypesSupported, conn.responseType) || !conn.client.allowsResponseType(conn.responseType) {
 		s.template(w, r, "error.html", map[string]string{
-			"error": `Field "response_type" must be "code"`,
+			"error": fmt.Sprintf(`Unsupported response_type %q`, params.Get("response_type")),
 		})
 		return
 	}
@@ -80,16 +102,191 @@ func (s *Server) openIDAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.Lock()
-	s.connections[conn.code] = conn
-	s.Unlock()
+	conn.responseMode = params.Get("response_mode")
+	if conn.responseMode == "" {
+		conn.responseMode = defaultResponseMode(conn.responseType)
+	}
+	if !slices.Contains(responseModesSupported, conn.responseMode) ||
+		(conn.responseType != responseTypeCode && strings.HasPrefix(conn.responseMode, responseModeQuery)) {
+		s.template(w, r, "error.html", map[string]string{
+			"errorType": "Bad request",
+			"error":     fmt.Sprintf(`Unsupported response_mode %q`, conn.responseMode),
+		})
+		return
+	}
+
+	// The nonce is required when the ID token is sent in the authorization response.
+	if conn.hasResponseType(responseTypeIDToken) && conn.nonce == "" {
+		s.authError(w, r, &conn, "invalid_request", "Required param: nonce")
+		return
+	}
+
+	// Access tokens can be requested for some protected resources (RFC 8707).
+	conn.resources = params["resource"]
+	if err := s.checkResources(conn.client, conn.resources); err != nil {
+		s.authError(w, r, &conn, "invalid_target", err.Error())
+		return
+	}
+
+	claims, err := parseClaimsRequest(params.Get("claims"))
+	if err != nil {
+		s.template(w, r, "error.html", map[string]string{
+			"errorType": "Bad request",
+			"error":     err.Error(),
+		})
+		return
+	}
+	conn.claims = claims
+
+	conn.prompt = strings.Fields(params.Get("prompt"))
+	for _, p := range conn.prompt {
+		if p == promptSelectAccount {
+			// Only one user can be logged in in each browser, so there are no accounts to choose from.
+			s.authError(w, r, &conn, "account_selection_required", "Account selection is not supported")
+			return
+		}
+		if !slices.Contains(promptValues, p) {
+			s.authError(w, r, &conn, "invalid_request", fmt.Sprintf("Unsupported prompt value %q", p))
+			return
+		}
+	}
+	if slices.Contains(conn.prompt, promptNone) && len(conn.prompt) > 1 {
+		s.authError(w, r, &conn, "invalid_request", `Prompt value "none" must be used alone`)
+		return
+	}
+
+	conn.maxAge = -1
+	if maxAge := params.Get("max_age"); maxAge != "" {
+		conn.maxAge, err = strconv.Atoi(maxAge)
+		if err != nil || conn.maxAge < 0 {
+			s.authError(w, r, &conn, "invalid_request", fmt.Sprintf("Invalid max_age %q", maxAge))
+			return
+		}
+	}
+
+	conn.acrValues = strings.Fields(params.Get("acr_values"))
+	if len(conn.acrValues) == 0 {
+		conn.acrValues = conn.client.defaultACRValues
+	}
+
+	conn.loginHint = params.Get("login_hint")
+	if hint := params.Get("id_token_hint"); hint != "" {
+		idToken, err := s.parseIDTokenHint(hint)
+		if err != nil {
+			s.authError(w, r, &conn, "invalid_request", err.Error())
+			return
+		}
+		conn.idTokenHint = idToken.SubjectIdentifier
+		if conn.loginHint == "" {
+			conn.loginHint = idToken.SubjectIdentifier
+		}
+	}
+
+	// If the user is already authenticated in this browser, there is no need to log in again.
+	if sess := s.getSession(w, r); sess != nil && s.sessionUsable(sess, &conn) {
+		conn.response = sess.Response
+		conn.authTime = sess.AuthTime
+		conn.sid = sess.SID
+		if !slices.Contains(conn.prompt, promptConsent) && s.hasConsent(sess, &conn) {
+			conn.consented = true
+		}
+		if slices.Contains(conn.prompt, promptNone) && conn.needsConsent() {
+			s.authError(w, r, &conn, "consent_required", "")
+			return
+		}
+		s.authComplete(w, r, &conn)
+		return
+	}
+
+	// There is no way to authenticate the user without showing the login page.
+	if slices.Contains(conn.prompt, promptNone) {
+		s.authError(w, r, &conn, "login_required", "")
+		return
+	}
+
+	s.saveConnection(&conn)
 
 	s.template(w, r, "login.html", map[string]string{
 		"postURL": filepath.Join(s.root, "/auth/login"),
 		"session": conn.code,
+		"login":   conn.loginHint,
 	})
 }
 
+// authComplete is called once the user has been authenticated.
+// It asks for the user consent if needed, and sends the authorization code
+// and, with the implicit and hybrid flows, the ID token to the client.
+func (s *Server) authComplete(w http.ResponseWriter, r *http.Request, conn *Connection) {
+	if conn.needsConsent() {
+		s.saveConnection(conn)
+
+		s.render(w, r, "consent.html", map[string]any{
+			"postURL": filepath.Join(s.root, "/auth/consent"),
+			"session": conn.code,
+			"login":   conn.response.Login,
+			"scopes":  strings.Join(conn.scopes, " "),
+			"apis":    s.consentAPIs(conn),
+		})
+		return
+	}
+
+	params := url.Values{}
+	if conn.hasResponseType(responseTypeCode) {
+		conn.authorized = true
+		s.saveConnection(conn)
+		params.Set("code", conn.code)
+	} else {
+		s.deleteConnection(conn.code)
+	}
+	if conn.hasResponseType(responseTypeIDToken) {
+		idToken, err := s.getIDToken(conn, params.Get("code"), "")
+		if err != nil {
+			http.Error(w, "Internal server error getting ID token.", http.StatusInternalServerError)
+			return
+		}
+		s.sessionAddClient(conn.sid, conn.client.id)
+		params.Set("id_token", idToken)
+	}
+	if state := s.sessionState(conn); state != "" {
+		params.Set("session_state", state)
+	}
+	s.authResponse(w, r, conn, params)
+}
+
+// needsConsent reports whether the user has to explicitly approve the authorization request.
+func (conn *Connection) needsConsent() bool {
+	if conn.consented {
+		return false
+	}
+	return conn.client.requireConsent || slices.Contains(conn.prompt, promptConsent)
+}
+
+// authConsent is the action called from the consent page.
+// It should have the value "session", and "approve" if the user agrees.
+func (s *Server) authConsent(w http.ResponseWriter, r *http.Request) {
+	session := r.PostFormValue("session")
+
+	conn := s.loadConnection(session)
+	if conn == nil || conn.authorized || conn.response.Type != ResponseTypeLoginOK {
+		s.template(w, r, "error.html", map[string]string{
+			"errorType": "Bad request",
+			"error":     fmt.Sprintf(`Invalid session %q from request`, session),
+		})
+		return
+	}
+	r = s.SetConnection(r, conn)
+
+	if r.PostFormValue("approve") == "" {
+		s.deleteConnection(session)
+		s.authError(w, r, conn, "access_denied", "The user did not approve the request")
+		return
+	}
+
+	conn.consented = true
+	s.addConsent(conn)
+	s.authComplete(w, r, conn)
+}
+
 // authLogin is the action called from the "form" where user has authenticated.
 // It should have the value "session" (and probably a few more) in the query
 func (s *Server) authLogin(w http.ResponseWriter, r *http.Request) {
@@ -103,23 +300,26 @@ func (s *Server) authLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	session := r.FormValue("session")
 
-	s.Lock()
-	conn, ok := s.connections[session]
-	s.Unlock()
-
-	if !ok {
+	conn := s.loadConnection(session)
+	if conn == nil || conn.authorized {
 		s.template(w, r, "error.html", map[string]string{
 			"error_type": "Bad request",
 			"error":      fmt.Sprintf(`Invalid session %q from request`, session),
 		})
 		return
 	}
+	r = s.SetConnection(r, conn)
 
 	req := Request{
-		Session: session,
-		Client:  conn.client.id,
-		Scopes:  conn.scopes,
-		Roles:   conn.client.allowedRoles,
+		Session:     session,
+		Client:      conn.client.id,
+		Scopes:      conn.scopes,
+		Roles:       conn.client.allowedRoles,
+		Claims:      conn.claims,
+		Prompt:      conn.prompt,
+		ACRValues:   conn.acrValues,
+		RequiredACR: s.requiredACR(conn),
+		LoginHint:   conn.loginHint,
 	}
 	req.Params = make(map[string]string)
 	for key := range r.Form {
@@ -127,24 +327,39 @@ func (s *Server) authLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := s.authenticator(&req)
+	if resp.Type == ResponseTypeLoginOK && !s.acrAccepted(conn, resp.ACR) {
+		// step-up authentication: the authenticator can ask for a stronger method.
+		weak := resp
+		req.StepUp = &weak
+		resp = s.authenticator(&req)
+	}
 
 	conn.response = resp
-
-	s.Lock()
-	s.connections[session] = conn
-	s.Unlock()
+	if resp.Type == ResponseTypeLoginOK {
+		if !s.acrAccepted(conn, resp.ACR) {
+			s.deleteConnection(session)
+			s.authError(w, r, conn, "unmet_authentication_requirements",
+				fmt.Sprintf("Authentication context %q does not meet the requirements", resp.ACR))
+			return
+		}
+		if !conn.subjectMatches(resp.Login) {
+			s.deleteConnection(session)
+			s.authError(w, r, conn, "login_required", `The user is not the one requested in the "sub" claim`)
+			return
+		}
+		if conn.idTokenHint != "" && resp.Login != conn.idTokenHint {
+			s.deleteConnection(session)
+			s.authError(w, r, conn, "login_required", "The user is not the one identified by id_token_hint")
+			return
+		}
+		conn.authTime = time.Now()
+		conn.sid = s.startSession(w, r, conn).SID
+	}
+	s.saveConnection(conn)
 
 	switch resp.Type {
 	case ResponseTypeLoginOK:
-		u, err := url.Parse(conn.redirectURI)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("redirect_uri: %v", err), http.StatusBadRequest)
-		}
-		q := u.Query()
-		q.Set("code", conn.code)
-		q.Set("state", conn.state)
-		u.RawQuery = q.Encode()
-		http.Redirect(w, r, u.String(), http.StatusFound)
+		s.authComplete(w, r, conn)
 		return
 	case ResponseTypeLoginFailed:
 		s.template(w, r, "login.html", map[string]string{
@@ -175,11 +390,26 @@ func (s *Server) authLogin(w http.ResponseWriter, r *http.Request) {
 // A Request is a message sent from the OIDC server to the authenticator,
 // asking if a given credentials are valid
 type Request struct {
-	Session string // unique ID for this user.
-	Client  string
-	Scopes  []string // scopes the user has requested
-	Roles   []string // list of allowed roles
-	Params  map[string]string
+	Session   string // unique ID for this user.
+	Client    string
+	Scopes    []string       // scopes the user has requested
+	Roles     []string       // list of allowed roles
+	Claims    *ClaimsRequest // individual claims requested by the client, if any
+	Prompt    []string       // values of the "prompt" parameter ("login", "consent"...)
+	ACRValues []string       // requested Authentication Context Class References, by preference
+	LoginHint string         // hint about the login identifier the user might use
+	Params    map[string]string
+
+	// RequiredACR are the Authentication Context Class References the authentication
+	// must satisfy (one of them, or a stronger one), if any.
+	RequiredACR []string
+
+	// StepUp is the response of the authenticator when the user has been authenticated,
+	// but not strongly enough for RequiredACR.  The authenticator is then called again
+	// with the same parameters, so it can ask for a stronger method (for instance,
+	// returning ResponseTypeRedirect to a page asking for a one-time password).
+	// If it does not, the authentication fails with "unmet_authentication_requirements".
+	StepUp *Response
 }
 
 // A Response is sent from the authenticator to the OIDC server, answering a Request.
@@ -206,6 +436,13 @@ type Response struct {
 	// e-mail address.  Used in claim "email".
 	Mail string
 
+	// Authentication Context Class Reference satisfied by the authentication.
+	// Used in claim "acr".
+	ACR string
+
+	// Authentication Methods References (such as "pwd" or "otp").  Used in claim "amr".
+	AMR []string
+
 	// Other claims:
 	Claims map[string]any
 }
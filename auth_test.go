@@ -0,0 +1,142 @@
+package jambo_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsentPage(t *testing.T) {
+	s, ts := newTestServer(t)
+	c := s.NewClient("consenting-client", testClientSecret)
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetRequireConsent(true)
+
+	resp := login(t, newBrowser(ts), ts, authParams(url.Values{"client_id": {"consenting-client"}}), "alice")
+	page := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: status %s; want the consent page", resp.Status)
+	}
+	for _, want := range []string{
+		`<h2 class="heading">Authorize consenting-client</h2>`,
+		`<p>consenting-client is requesting access to your account (alice)`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("consent page does not contain %q:\n%s", want, page)
+		}
+	}
+}
+
+// authRedirect sends an authorization request without logging in.  It returns
+// where the browser is redirected to, or nil if the server shows the login form.
+func authRedirect(t *testing.T, browser *http.Client, ts *httptest.Server, params url.Values) *url.URL {
+	t.Helper()
+	resp, err := browser.Get(ts.URL + "/oidc/auth?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readBody(t, resp)
+	if sessionRE.MatchString(page) {
+		return nil
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization request: status %d; want a redirection or the login form:\n%s", resp.StatusCode, page)
+	}
+	return location
+}
+
+func TestPrompt(t *testing.T) {
+	s, ts := newTestServer(t)
+	c := s.NewClient("consenting-client", testClientSecret)
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetRequireConsent(true)
+
+	// Without a session, prompt=none cannot log in.
+	browser := newBrowser(ts)
+	if location := authRedirect(t, browser, ts, authParams(url.Values{"prompt": {"none"}})); location == nil || location.Query().Get("error") != "login_required" {
+		t.Errorf("prompt=none without session: redirected to %v; want login_required", location)
+	}
+
+	authCode(t, browser, ts, authParams(nil))
+	tests := []struct {
+		params    url.Values
+		wantLogin bool
+		wantError string
+	}{
+		{url.Values{}, false, ""},
+		{url.Values{"prompt": {"none"}}, false, ""},
+		{url.Values{"prompt": {"none"}, "client_id": {"consenting-client"}}, false, "consent_required"},
+		{url.Values{"prompt": {"login"}}, true, ""},
+		{url.Values{"prompt": {"login consent"}}, true, ""},
+		{url.Values{"prompt": {"none login"}}, false, "invalid_request"},
+		{url.Values{"prompt": {"select_account"}}, false, "account_selection_required"},
+		{url.Values{"prompt": {"unknown"}}, false, "invalid_request"},
+	}
+	for _, test := range tests {
+		location := authRedirect(t, browser, ts, authParams(test.params))
+		if test.wantLogin {
+			if location != nil {
+				t.Errorf("%v: redirected to %s; want the login form", test.params, location)
+			}
+			continue
+		}
+		if location == nil {
+			t.Errorf("%v: login form shown; want a redirection", test.params)
+			continue
+		}
+		if got := location.Query().Get("error"); got != test.wantError || (got == "" && location.Query().Get("code") == "") {
+			t.Errorf("%v: redirected to %s; want error %q", test.params, location, test.wantError)
+		}
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	_, ts := newTestServer(t)
+	browser := newBrowser(ts)
+
+	start := time.Now().Unix()
+	status, tokens := postForm(t, ts, "/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {authCode(t, browser, ts, authParams(nil))},
+		"redirect_uri": {testRedirectURI},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token endpoint: status %d: %v", status, tokens)
+	}
+	authTime, _ := jwtClaims(t, tokens["id_token"].(string))["auth_time"].(float64)
+	if authTime < float64(start) || authTime > float64(time.Now().Unix()) {
+		t.Fatalf("ID token has auth_time %v; want the time of the login", authTime)
+	}
+
+	// The session is used if it is recent enough, keeping the time of the login.
+	time.Sleep(1100 * time.Millisecond)
+	location := authRedirect(t, browser, ts, authParams(url.Values{"max_age": {"3600"}}))
+	if location == nil {
+		t.Fatal("max_age=3600: login form shown; want the session to be used")
+	}
+	status, tokens = postForm(t, ts, "/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {location.Query().Get("code")},
+		"redirect_uri": {testRedirectURI},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token endpoint: status %d: %v", status, tokens)
+	}
+	if got := jwtClaims(t, tokens["id_token"].(string))["auth_time"]; got != authTime {
+		t.Errorf("ID token with the session has auth_time %v; want the time of the login (%v)", got, authTime)
+	}
+
+	if location := authRedirect(t, browser, ts, authParams(url.Values{"max_age": {"0"}})); location != nil {
+		t.Errorf("max_age=0: redirected to %s; want the login form", location)
+	}
+	for _, maxAge := range []string{"-1", "x"} {
+		location := authRedirect(t, browser, ts, authParams(url.Values{"max_age": {maxAge}}))
+		if location == nil || location.Query().Get("error") != "invalid_request" {
+			t.Errorf("max_age=%s: redirected to %v; want invalid_request", maxAge, location)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package jambo
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// backchannelLogoutEvent is the member of the "events" claim of logout tokens.
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+const (
+	backchannelLogoutAttempts = 4           // maximum number of delivery attempts
+	backchannelLogoutBackoff  = time.Second // delay before the first retry, doubled on each attempt
+	logoutDeliveriesMax       = 1000        // number of deliveries kept in the log
+)
+
+// A LogoutToken is sent to the clients to notify them that a session has ended.
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+type LogoutToken struct {
+	Issuer     string              `json:"iss"`
+	Subject    string              `json:"sub,omitempty"`
+	Audience   string              `json:"aud"`
+	IssuedAt   int64               `json:"iat"`
+	Expiration int64               `json:"exp"`
+	JWTID      string              `json:"jti"`
+	SessionID  string              `json:"sid,omitempty"`
+	Events     map[string]struct{} `json:"events"`
+}
+
+// A LogoutDelivery is the record of a logout token sent to a client.
+type LogoutDelivery struct {
+	Client    string
+	URI       string
+	Subject   string
+	SessionID string
+	Time      time.Time // time of the last attempt
+	Attempts  int
+	Status    int    // HTTP status code of the last attempt
+	Error     string // empty if the token was delivered successfully
+}
+
+// SetBackchannelLogoutURI sets the URI where the client will receive
+// logout tokens when a session in which it has received tokens ends.
+func (c *Client) SetBackchannelLogoutURI(uri string) {
+	c.backchannelLogoutURI = uri
+}
+
+// LogoutDeliveries returns the log of the most recent back-channel logout deliveries.
+func (s *Server) LogoutDeliveries() []LogoutDelivery {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]LogoutDelivery(nil), s.logoutDeliveries...)
+}
+
+// backchannelLogout sends, in the background, a logout token to all the clients
+// with a back-channel logout URI.
+func (s *Server) backchannelLogout(sess *ssoSession) {
+	for _, id := range sess.Clients {
+		client := s.findClient(id)
+		if client == nil || client.backchannelLogoutURI == "" {
+			continue
+		}
+		now := time.Now()
+		token, err := s.sign(LogoutToken{
+			Issuer:     s.issuer,
+			Subject:    sess.Response.Login,
+			Audience:   client.id,
+			IssuedAt:   now.Unix(),
+			Expiration: now.Unix() + 120,
+			JWTID:      rand.Text(),
+			SessionID:  sess.SID,
+			Events:     map[string]struct{}{backchannelLogoutEvent: {}},
+		}, "logout+jwt")
+		if err != nil {
+			log.Printf("back-channel logout for client %q: %v", client.id, err)
+			continue
+		}
+		delivery := LogoutDelivery{
+			Client:    client.id,
+			URI:       client.backchannelLogoutURI,
+			Subject:   sess.Response.Login,
+			SessionID: sess.SID,
+		}
+		go s.deliverLogoutToken(delivery, token)
+	}
+}
+
+// deliverLogoutToken posts a logout token to a client, retrying on failure,
+// and records the result in the delivery log.
+func (s *Server) deliverLogoutToken(delivery LogoutDelivery, token string) {
+	backoff := backchannelLogoutBackoff
+	for {
+		delivery.Attempts++
+		delivery.Time = time.Now()
+		delivery.Status, delivery.Error = 0, ""
+
+		resp, err := s.httpClient.Post(delivery.URI, "application/x-www-form-urlencoded",
+			strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			resp.Body.Close()
+			delivery.Status = resp.StatusCode
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+				delivery.Error = fmt.Sprintf("unexpected status %q", resp.Status)
+			}
+		}
+
+		// A 400 Bad Request means the client has rejected the token: do not retry.
+		if delivery.Error == "" || delivery.Status == http.StatusBadRequest || delivery.Attempts >= backchannelLogoutAttempts {
+			break
+		}
+		if _DEBUG {
+			log.Printf("back-channel logout to %s failed (attempt %d): %s\n", delivery.URI, delivery.Attempts, delivery.Error)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	s.Lock()
+	s.logoutDeliveries = append(s.logoutDeliveries, delivery)
+	if n := len(s.logoutDeliveries); n > logoutDeliveriesMax {
+		s.logoutDeliveries = s.logoutDeliveries[n-logoutDeliveriesMax:]
+	}
+	s.Unlock()
+}
@@ -0,0 +1,183 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// logoutReceiver returns the back-channel logout URI of a client, which answers
+// with the given status codes (the last one is repeated), and a channel with the
+// logout tokens it receives.
+func logoutReceiver(t *testing.T, statuses ...int) (string, chan string) {
+	t.Helper()
+	tokens := make(chan string, 10)
+	var mu sync.Mutex
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		mu.Unlock()
+		tokens <- r.PostFormValue("logout_token")
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rs.Close)
+	return rs.URL + "/backchannel-logout", tokens
+}
+
+// receiveToken waits for a logout token.
+func receiveToken(t *testing.T, tokens chan string) string {
+	t.Helper()
+	select {
+	case token := <-tokens:
+		return token
+	case <-time.After(5 * time.Second):
+		t.Fatal("no logout token received")
+	}
+	return ""
+}
+
+// logoutTokenClaims checks the signature and the "typ" header of a logout token,
+// and returns its claims.
+func logoutTokenClaims(t *testing.T, ts *httptest.Server, token string) map[string]any {
+	t.Helper()
+	jws, err := jose.ParseSigned(token, []jose.SignatureAlgorithm{jose.RS256})
+	if err != nil {
+		t.Fatalf("logout token %q: %v", token, err)
+	}
+	if typ := jws.Signatures[0].Header.ExtraHeaders[jose.HeaderType]; typ != "logout+jwt" {
+		t.Errorf("logout token has typ %v; want logout+jwt", typ)
+	}
+	jwks := serverKeys(t, ts)
+	keys := jwks.Key(jws.Signatures[0].Header.KeyID)
+	if len(keys) == 0 {
+		t.Fatalf("logout token signed with an unknown key %q", jws.Signatures[0].Header.KeyID)
+	}
+	payload, err := jws.Verify(keys[0])
+	if err != nil {
+		t.Fatalf("logout token: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+// waitDeliveries waits until the server has recorded n logout deliveries.
+func waitDeliveries(t *testing.T, s *jambo.Server, n int) []jambo.LogoutDelivery {
+	t.Helper()
+	for range 100 {
+		if deliveries := s.LogoutDeliveries(); len(deliveries) >= n {
+			return deliveries
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("logout deliveries: %v; want %d", s.LogoutDeliveries(), n)
+	return nil
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	uri, tokens := logoutReceiver(t, http.StatusOK)
+	s, ts := newTestServer(t, func(c *jambo.Client) { c.SetBackchannelLogoutURI(uri) })
+	other := s.NewClient("other-client", testClientSecret)
+	other.AddAllowedRedirectURIs(testRedirectURI)
+	other.SetBackchannelLogoutURI(uri)
+
+	// Only the test client gets tokens in the session, so only it is notified.
+	browser := newBrowser(ts)
+	location, page := authorize(t, browser, ts, authParams(nil))
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	idToken := clientIDToken(t, ts, testClientID, location)
+	authRedirect(t, browser, ts, authParams(url.Values{"client_id": {"other-client"}}))
+
+	start := time.Now().Unix()
+	resp, err := browser.PostForm(ts.URL+"/oidc/logout", url.Values{"confirm": {"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+
+	claims := logoutTokenClaims(t, ts, receiveToken(t, tokens))
+	if claims["iss"] != ts.URL+"/oidc" || claims["aud"] != testClientID || claims["sub"] != "alice" || claims["sid"] != idToken["sid"] {
+		t.Errorf("logout token has iss %v, aud %v, sub %v and sid %v; want %s, %s, alice and %v",
+			claims["iss"], claims["aud"], claims["sub"], claims["sid"], ts.URL+"/oidc", testClientID, idToken["sid"])
+	}
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if iat < float64(start) || iat > float64(time.Now().Unix()) || exp <= iat {
+		t.Errorf("logout token has iat %v and exp %v; want the time of the logout and later", claims["iat"], claims["exp"])
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		t.Errorf("logout token has jti %v; want a unique identifier", claims["jti"])
+	}
+	events, _ := claims["events"].(map[string]any)
+	if event, ok := events["http://schemas.openid.net/event/backchannel-logout"].(map[string]any); len(events) != 1 || !ok || len(event) != 0 {
+		t.Errorf("logout token has events %v; want only the back-channel logout event, with an empty object", claims["events"])
+	}
+	if _, ok := claims["nonce"]; ok {
+		t.Errorf("logout token has a nonce %v", claims["nonce"])
+	}
+
+	deliveries := waitDeliveries(t, s, 1)
+	if d := deliveries[0]; d.Client != testClientID || d.URI != uri || d.SessionID != idToken["sid"] || d.Attempts != 1 || d.Status != http.StatusOK || d.Error != "" {
+		t.Errorf("logout delivery %+v; want a successful delivery to %s", d, testClientID)
+	}
+	select {
+	case token := <-tokens:
+		t.Errorf("logout token for a client without tokens in the session: %v", logoutTokenClaims(t, ts, token)["aud"])
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// LogoutUser notifies every session, and every token has a different jti.
+	location, _ = authorize(t, browser, ts, authParams(nil))
+	clientIDToken(t, ts, testClientID, location)
+	getTokens(t, ts, authParams(nil))
+	if err := s.LogoutUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	first := logoutTokenClaims(t, ts, receiveToken(t, tokens))
+	second := logoutTokenClaims(t, ts, receiveToken(t, tokens))
+	if first["jti"] == second["jti"] || first["jti"] == claims["jti"] || first["sid"] == second["sid"] {
+		t.Errorf("LogoutUser: logout tokens with jti %v and %v and sid %v and %v; want different ones",
+			first["jti"], second["jti"], first["sid"], second["sid"])
+	}
+}
+
+func TestBackchannelLogoutRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+		wantError    bool
+	}{
+		{"no content", []int{http.StatusNoContent}, 1, http.StatusNoContent, false},
+		{"temporary failure", []int{http.StatusServiceUnavailable, http.StatusOK}, 2, http.StatusOK, false},
+		{"token rejected", []int{http.StatusBadRequest, http.StatusOK}, 1, http.StatusBadRequest, true},
+	}
+	for _, test := range tests {
+		uri, tokens := logoutReceiver(t, test.statuses...)
+		s, ts := newTestServer(t, func(c *jambo.Client) { c.SetBackchannelLogoutURI(uri) })
+		getTokens(t, ts, authParams(nil))
+		if err := s.LogoutUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		receiveToken(t, tokens)
+		d := waitDeliveries(t, s, 1)[0]
+		if d.Attempts != test.wantAttempts || d.Status != test.wantStatus || (d.Error != "") != test.wantError {
+			t.Errorf("%s: logout delivery %+v; want %d attempts, status %d and error %v", test.name, d, test.wantAttempts, test.wantStatus, test.wantError)
+		}
+	}
+}
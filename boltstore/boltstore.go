@@ -0,0 +1,177 @@
+// Package boltstore provides a [jambo.Storage] which keeps the values in
+// a local file, using [bbolt].
+//
+// A bbolt database can only be opened by one process at a time, so this
+// storage lets a server keep its state across restarts, but it cannot be
+// shared by several servers.
+//
+// [bbolt]: https://github.com/etcd-io/bbolt
+package boltstore
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/cespedes/jambo"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Storage is a [jambo.Storage] backed by a bbolt database.
+// Every [jambo.Storage] bucket is kept in a bbolt bucket,
+// and every value is prefixed with its expiration time.
+type Storage struct {
+	db *bolt.DB
+}
+
+// New opens (or creates) a bbolt database and returns a Storage which uses it.
+func New(path string) (*Storage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{db: db}, nil
+}
+
+// Close closes the database.
+func (st *Storage) Close() error {
+	return st.db.Close()
+}
+
+func encode(value []byte, expires time.Time) []byte {
+	data := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(expires.UnixNano()))
+	copy(data[8:], value)
+	return data
+}
+
+// decode returns a copy of a stored value, or false if it has expired.
+func decode(data []byte) ([]byte, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	if time.Now().After(expires) {
+		return nil, false
+	}
+	return append([]byte{}, data[8:]...), true
+}
+
+// Put stores a value, replacing the previous one (if any).
+func (st *Storage) Put(bucket, key string, value []byte, expires time.Time) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), encode(value, expires))
+	})
+}
+
+// Create stores a value only if the key does not exist yet.
+func (st *Storage) Create(bucket, key string, value []byte, expires time.Time) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		if _, ok := decode(b.Get([]byte(key))); ok {
+			return jambo.ErrAlreadyExists
+		}
+		return b.Put([]byte(key), encode(value, expires))
+	})
+}
+
+// Get returns a value.
+func (st *Storage) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return jambo.ErrNotFound
+		}
+		var ok bool
+		if value, ok = decode(b.Get([]byte(key))); !ok {
+			return jambo.ErrNotFound
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Take returns a value and deletes it.
+func (st *Storage) Take(bucket, key string) ([]byte, error) {
+	var (
+		value []byte
+		ok    bool
+	)
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		value, ok = decode(data)
+		return b.Delete([]byte(key))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, jambo.ErrNotFound
+	}
+	return value, nil
+}
+
+// Delete removes a value.
+func (st *Storage) Delete(bucket, key string) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// List returns all the values in a bucket which have not expired.
+func (st *Storage) List(bucket string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if value, ok := decode(v); ok {
+				values[string(k)] = value
+			}
+			return nil
+		})
+	})
+	return values, err
+}
+
+// Expire removes the expired values from all the buckets.
+// Expired values are never returned, but they are only removed
+// from the file when Expire is called.
+func (st *Storage) Expire() error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; {
+				if _, ok := decode(v); !ok {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+					k, v = c.Seek(k)
+					continue
+				}
+				k, v = c.Next()
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package boltstore_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cespedes/jambo/boltstore"
+	"github.com/cespedes/jambo/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	st, err := boltstore.New(filepath.Join(t.TempDir(), "jambo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if err := storagetest.TestStorage(st); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,29 @@
+package jambo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+)
+
+// sessionState returns the "session_state" parameter for a successful authorization
+// response, or an empty string if the user has no browser session.  It is checked by
+// the check_session_iframe ("web/static/check_session.html") with the same algorithm.
+// https://openid.net/specs/openid-connect-session-1_0.html#CreatingUpdatingSessions
+func (s *Server) sessionState(conn *Connection) string {
+	sess := s.findSession(conn.sid)
+	if sess == nil {
+		return ""
+	}
+
+	u, err := url.Parse(conn.redirectURI)
+	if err != nil {
+		return ""
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	salt := rand.Text()
+	sum := sha256.Sum256([]byte(conn.client.id + " " + origin + " " + sess.BrowserState + " " + salt))
+	return hex.EncodeToString(sum[:]) + "." + salt
+}
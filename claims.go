@@ -0,0 +1,155 @@
+package jambo
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// A ClaimsRequest is the content of the "claims" request parameter, used by clients
+// to ask for individual claims to be returned in the ID token or by the userinfo endpoint.
+// https://openid.net/specs/openid-connect-core-1_0.html#ClaimsParameter
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// A ClaimRequest holds the requirements for an individual claim.
+// A nil *ClaimRequest means the claim is requested in the default manner.
+//
+// A claim requested with Value or Values is only returned if it has one of them;
+// if it is "sub", the authentication fails if the user is not the requested one.
+// Essential is passed to the authenticator, which decides what to do if it cannot
+// provide an essential claim; the server only enforces it for "acr".
+type ClaimRequest struct {
+	Essential bool  `json:"essential,omitempty"`
+	Value     any   `json:"value,omitempty"`
+	Values    []any `json:"values,omitempty"`
+}
+
+// Targets of a claims request:
+const (
+	claimsTargetIDToken  = "id_token"
+	claimsTargetUserInfo = "userinfo"
+)
+
+// scopeClaims is the list of standard claims returned for each scope.
+var scopeClaims = map[string][]string{
+	scopeProfile: {"name", "preferred_username"},
+	scopeEmail:   {"email", "email_verified"},
+}
+
+func parseClaimsRequest(s string) (*ClaimsRequest, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var cr ClaimsRequest
+	if err := json.Unmarshal([]byte(s), &cr); err != nil {
+		return nil, fmt.Errorf("invalid claims parameter: %w", err)
+	}
+	return &cr, nil
+}
+
+// claims returns the list of individual claims requested for a given target.
+func (cr *ClaimsRequest) claims(target string) map[string]*ClaimRequest {
+	if cr == nil {
+		return nil
+	}
+	switch target {
+	case claimsTargetIDToken:
+		return cr.IDToken
+	case claimsTargetUserInfo:
+		return cr.UserInfo
+	}
+	return nil
+}
+
+// Requested reports whether a claim has been requested for a given target
+// ("id_token" or "userinfo"), and the requirements for it.
+func (cr *ClaimsRequest) Requested(target, claim string) (*ClaimRequest, bool) {
+	req, ok := cr.claims(target)[claim]
+	return req, ok
+}
+
+// matches reports whether a claim with a given value satisfies the "value"
+// or "values" requirements of a request, if it has any.
+func (req *ClaimRequest) matches(value any) bool {
+	if req == nil || (req.Value == nil && len(req.Values) == 0) {
+		return true
+	}
+	// Values are compared by their JSON encoding, as they come from JSON.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(append([]any{req.Value}, req.Values...), func(want any) bool {
+		wantData, err := json.Marshal(want)
+		return want != nil && err == nil && string(wantData) == string(data)
+	})
+}
+
+// claimMatches reports whether a claim with a given value can be returned for a given target,
+// according to the requirements in the claims request parameter, if any.
+func (conn *Connection) claimMatches(target, claim string, value any) bool {
+	req, _ := conn.claims.Requested(target, claim)
+	return req.matches(value)
+}
+
+// wantClaim reports whether a standard claim with a given value must be returned for
+// a given target, either because it was requested in a scope or in the claims request
+// parameter, unless the claims request parameter asks for a different value.
+func (conn *Connection) wantClaim(target, claim string, value any) bool {
+	req, ok := conn.claims.Requested(target, claim)
+	if !req.matches(value) {
+		return false
+	}
+	for _, scope := range conn.scopes {
+		if slices.Contains(scopeClaims[scope], claim) {
+			return true
+		}
+	}
+	return ok
+}
+
+// subjectMatches reports whether a user is the one requested with the "sub" claim
+// in the claims request parameter, if any.
+func (conn *Connection) subjectMatches(login string) bool {
+	return conn.claimMatches(claimsTargetIDToken, "sub", login) &&
+		conn.claimMatches(claimsTargetUserInfo, "sub", login)
+}
+
+// extraClaims returns the claims sent by the authenticator in [Response.Claims]
+// to be returned for a given target: all of them, except those with a value
+// different from the one requested in the claims request parameter.
+func (conn *Connection) extraClaims(target string) map[string]any {
+	var claims map[string]any
+	for k, v := range conn.response.Claims {
+		if conn.claimMatches(target, k, v) {
+			if claims == nil {
+				claims = make(map[string]any)
+			}
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+// userClaims returns the claims about the end-user to be returned for a given target.
+func (conn *Connection) userClaims(target string) map[string]any {
+	claims := make(map[string]any)
+	if conn.response.Login != "" && conn.wantClaim(target, "preferred_username", conn.response.Login) {
+		claims["preferred_username"] = conn.response.Login
+	}
+	if conn.response.Name != "" && conn.wantClaim(target, "name", conn.response.Name) {
+		claims["name"] = conn.response.Name
+	}
+	if conn.response.Mail != "" && conn.wantClaim(target, "email", conn.response.Mail) {
+		claims["email"] = conn.response.Mail
+	}
+	if conn.response.Mail != "" && conn.wantClaim(target, "email_verified", true) {
+		claims["email_verified"] = true
+	}
+	maps.Copy(claims, conn.extraClaims(target))
+	return claims
+}
@@ -0,0 +1,80 @@
+package jambo_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/cespedes/jambo"
+)
+
+func TestClaimsRequestValues(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetAuthenticator(func(req *jambo.Request) jambo.Response {
+		return jambo.Response{
+			Type:   jambo.ResponseTypeLoginOK,
+			Login:  req.Params["login"],
+			Name:   "Alice",
+			Mail:   "alice@example.com",
+			Claims: map[string]any{"department": "sales"},
+		}
+	})
+
+	tests := []struct {
+		claims       string
+		idToken      map[string]any // claims which must (or must not, if nil) be in the ID token
+		userInfo     map[string]any // same, for the userinfo response
+		wantLoginErr bool
+	}{
+		{
+			claims:   `{"id_token":{"name":null},"userinfo":{"email":{"value":"alice@example.com"}}}`,
+			idToken:  map[string]any{"name": "Alice", "email": nil},
+			userInfo: map[string]any{"email": "alice@example.com", "name": nil},
+		},
+		{
+			claims:   `{"userinfo":{"email":{"value":"bob@example.com"},"department":{"values":["hr","it"]}}}`,
+			idToken:  map[string]any{"department": "sales"},
+			userInfo: map[string]any{"email": nil, "department": nil},
+		},
+		{
+			claims:   `{"id_token":{"department":{"values":["hr","sales"]}}}`,
+			idToken:  map[string]any{"department": "sales"},
+			userInfo: map[string]any{"department": "sales"},
+		},
+		{
+			claims:   `{"id_token":{"sub":{"value":"alice"}}}`,
+			idToken:  map[string]any{"sub": "alice"},
+			userInfo: map[string]any{"sub": "alice"},
+		},
+		{
+			claims:       `{"id_token":{"sub":{"value":"bob"}}}`,
+			wantLoginErr: true,
+		},
+	}
+	for _, test := range tests {
+		params := authParams(url.Values{"scope": {"openid"}, "claims": {test.claims}})
+		if test.wantLoginErr {
+			resp := login(t, newBrowser(ts), ts, params, "alice")
+			resp.Body.Close()
+			location, _ := url.Parse(resp.Header.Get("Location"))
+			if got := location.Query().Get("error"); got != "login_required" {
+				t.Errorf("claims %s: error = %q; want login_required", test.claims, got)
+			}
+			continue
+		}
+
+		tokens := getTokens(t, ts, params)
+		idToken := jwtClaims(t, tokens["id_token"].(string))
+		userInfo := getUserInfo(t, ts, tokens["access_token"].(string))
+		for name, got := range map[string]map[string]any{"ID token": idToken, "userinfo": userInfo} {
+			want := test.idToken
+			if name == "userinfo" {
+				want = test.userInfo
+			}
+			for claim, value := range want {
+				if got[claim] != value {
+					t.Errorf("claims %s: %s has %s = %v; want %v", test.claims, name, claim, got[claim], value)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package jambo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// clientAssertionTypeJWT is the value of "client_assertion_type" used with
+// the "private_key_jwt" and "client_secret_jwt" authentication methods (RFC 7523).
+const clientAssertionTypeJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Algorithms accepted in client assertions:
+var (
+	assertionKeyAlgs = []jose.SignatureAlgorithm{
+		jose.RS256, jose.RS384, jose.RS512,
+		jose.PS256, jose.PS384, jose.PS512,
+		jose.ES256, jose.ES384, jose.ES512,
+		jose.EdDSA,
+	}
+	assertionSecretAlgs = []jose.SignatureAlgorithm{jose.HS256, jose.HS384, jose.HS512}
+)
+
+// assertionSecretSizes are the minimum lengths of the secrets used with each HMAC
+// algorithm: the size of its hash (RFC 7518, section 3.2).
+var assertionSecretSizes = map[jose.SignatureAlgorithm]int{
+	jose.HS256: 32,
+	jose.HS384: 48,
+	jose.HS512: 64,
+}
+
+// assertionLeeway is the clock skew allowed when checking the times in a client assertion.
+const assertionLeeway = 1 * time.Minute
+
+// algNames returns the names of a list of algorithms.
+func algNames[T ~string](algs ...[]T) []string {
+	var names []string
+	for _, alg := range slices.Concat(algs...) {
+		names = append(names, string(alg))
+	}
+	return names
+}
+
+// verifyClientAssertion checks a JWT sent by a client to authenticate itself
+// (RFC 7523, section 2.2, and OpenID Connect Core, section 9).
+// It returns the client and the authentication method used.
+func (s *Server) verifyClientAssertion(r *http.Request, assertion string) (*Client, string, error) {
+	token, err := jwt.ParseSigned(assertion, slices.Concat(assertionKeyAlgs, assertionSecretAlgs))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The client is identified by the "sub" claim, which is only trusted once the signature is checked.
+	var unverified jwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return nil, "", err
+	}
+	client := s.findClient(unverified.Subject)
+	if client == nil {
+		return nil, "", fmt.Errorf("unknown client %q", unverified.Subject)
+	}
+
+	var (
+		claims jwt.Claims
+		method string
+	)
+	header := token.Headers[0]
+	if slices.Contains(assertionSecretAlgs, jose.SignatureAlgorithm(header.Algorithm)) {
+		method = authMethodSecretJWT
+		secret := client.checkAssertionSecret(token, &claims)
+		if secret == nil {
+			return nil, "", errors.New("invalid signature")
+		}
+		s.recordSecretUse(client, secret)
+	} else {
+		method = authMethodPrivateKeyJWT
+		keys, err := s.clientKeys(client, header.KeyID)
+		if err != nil {
+			return nil, "", err
+		}
+		if !slices.ContainsFunc(keys, func(key jose.JSONWebKey) bool {
+			return token.Claims(key, &claims) == nil
+		}) {
+			return nil, "", errors.New("invalid signature")
+		}
+	}
+
+	audiences := jwt.Audience{s.issuer, s.issuer + "/token", s.issuer + r.URL.Path}
+	err = claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:      client.id,
+		Subject:     client.id,
+		AnyAudience: audiences,
+	}, assertionLeeway)
+	if err != nil {
+		return nil, "", err
+	}
+	if claims.Expiry == nil || claims.ID == "" {
+		return nil, "", errors.New(`missing "exp" or "jti" claim`)
+	}
+
+	// Every assertion can only be used once; its "jti" is remembered until it expires.
+	expires := claims.Expiry.Time().Add(assertionLeeway)
+	err = s.storage.Create(bucketAssertions, client.id+" "+claims.ID, nil, expires)
+	if errors.Is(err, ErrAlreadyExists) {
+		return nil, "", fmt.Errorf("replayed assertion (jti %q)", claims.ID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return client, method, nil
+}
+
+// checkAssertionSecret checks the HMAC of a client assertion with the secrets of a client,
+// storing its claims in the value pointed to by claims.
+// It returns the secret used, or nil if none of them is valid.
+// Hashed secrets cannot be used, because the server needs to know the secret itself,
+// and neither can the ones shorter than the hash of the algorithm.
+func (c *Client) checkAssertionSecret(token *jwt.JSONWebToken, claims *jwt.Claims) *ClientSecret {
+	now := time.Now()
+	minSize := assertionSecretSizes[jose.SignatureAlgorithm(token.Headers[0].Algorithm)]
+	for i, cs := range c.secrets {
+		if cs.hashed() || cs.expired(now) || len(cs.Secret) < minSize {
+			continue
+		}
+		if token.Claims([]byte(cs.Secret), claims) == nil {
+			return &c.secrets[i]
+		}
+	}
+	return nil
+}
+
+// allowsAuthMethod reports whether a client can authenticate itself with a given method.
+// Clients registered with a JWT-based method can only use that method;
+// clients without a registered method can use any of them.
+func (c *Client) allowsAuthMethod(method string) bool {
+	switch c.tokenEndpointAuthMethod {
+	case "":
+		return true
+	case authMethodSecretBasic, authMethodSecretPost:
+		return strings.HasPrefix(method, "client_secret_") && method != authMethodSecretJWT
+	}
+	return method == c.tokenEndpointAuthMethod
+}
@@ -0,0 +1,162 @@
+package jambo_test
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// assertionClaims returns the claims of a client assertion from the test client
+// to ts, with the claims in extra replacing the default ones (or removing them, if nil).
+func assertionClaims(ts *httptest.Server, extra map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss": testClientID,
+		"sub": testClientID,
+		"aud": ts.URL + "/oidc/token",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"jti": rand.Text(),
+	}
+	for name, value := range extra {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+// hs256JWT returns a JWT with some claims signed with HS256 and a secret.
+// Unlike go-jose, it does not refuse to use short secrets.
+func hs256JWT(secret string, claims any) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, _ := json.Marshal(claims)
+	input := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// assertionTokens exchanges a new authorization code, authenticating the test
+// client with a client assertion.  It returns the status code and the decoded response.
+func assertionTokens(t *testing.T, ts *httptest.Server, assertion string) (int, map[string]any) {
+	t.Helper()
+	params := codeParams(t, ts, "openid")
+	params.Set("client_assertion_type", clientAssertionType)
+	params.Set("client_assertion", assertion)
+	resp, err := ts.Client().PostForm(ts.URL+"/oidc/token", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	return resp.StatusCode, body
+}
+
+func TestPrivateKeyJWT(t *testing.T) {
+	key, jwks := newClientKey(t, "assertion-key")
+	otherKey, _ := newClientKey(t, "assertion-key")
+	s, ts := newTestServer(t, func(c *jambo.Client) { c.SetJWKS(jwks) })
+	other := s.NewClient("other", "")
+	other.AddAllowedRedirectURIs(testRedirectURI)
+
+	replayed := signJWT(t, key, "", assertionClaims(ts, nil))
+	tests := []struct {
+		name      string
+		assertion string
+		wantOK    bool
+	}{
+		{"valid", replayed, true},
+		{"issuer as audience", signJWT(t, key, "", assertionClaims(ts, map[string]any{"aud": ts.URL + "/oidc"})), true},
+		{"replayed jti", replayed, false},
+		{"wrong aud", signJWT(t, key, "", assertionClaims(ts, map[string]any{"aud": "https://other.example/token"})), false},
+		{"wrong iss", signJWT(t, key, "", assertionClaims(ts, map[string]any{"iss": "other"})), false},
+		{"wrong sub", signJWT(t, key, "", assertionClaims(ts, map[string]any{"sub": "other"})), false},
+		{"unknown sub", signJWT(t, key, "", assertionClaims(ts, map[string]any{"iss": "unknown", "sub": "unknown"})), false},
+		{"expired", signJWT(t, key, "", assertionClaims(ts, map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), false},
+		{"no exp", signJWT(t, key, "", assertionClaims(ts, map[string]any{"exp": nil})), false},
+		{"no jti", signJWT(t, key, "", assertionClaims(ts, map[string]any{"jti": nil})), false},
+		{"signed with another key", signJWT(t, otherKey, "", assertionClaims(ts, nil)), false},
+		{"unsigned", unsignedJWT(assertionClaims(ts, nil)), false},
+	}
+	for _, test := range tests {
+		status, body := assertionTokens(t, ts, test.assertion)
+		if test.wantOK && status != http.StatusOK {
+			t.Errorf("%s: status %d: %v; want %d", test.name, status, body, http.StatusOK)
+		}
+		if !test.wantOK && (status != http.StatusUnauthorized || body["error"] != "invalid_client") {
+			t.Errorf("%s: status %d: %v; want %d, invalid_client", test.name, status, body, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestClientSecretJWT(t *testing.T) {
+	longSecret := strings.Repeat("0123456789abcdef", 2)
+	hashed, _ := jambo.HashSecret("hashed-"+longSecret, jambo.SecretHashBcrypt)
+	var c *jambo.Client
+	_, ts := newTestServer(t, func(tc *jambo.Client) {
+		c = tc
+		c.AddSecret(longSecret, time.Time{})
+		c.AddSecret(hashed, time.Time{})
+	})
+
+	tests := []struct {
+		name      string
+		assertion string
+		wantOK    bool
+	}{
+		{"long secret", hs256JWT(longSecret, assertionClaims(ts, nil)), true},
+		{"short secret", hs256JWT(testClientSecret, assertionClaims(ts, nil)), false},
+		{"hashed secret", hs256JWT("hashed-"+longSecret, assertionClaims(ts, nil)), false},
+		{"hash as secret", hs256JWT(hashed, assertionClaims(ts, nil)), false},
+		{"wrong aud", hs256JWT(longSecret, assertionClaims(ts, map[string]any{"aud": "https://other.example/token"})), false},
+		{"expired", hs256JWT(longSecret, assertionClaims(ts, map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), false},
+	}
+	for _, test := range tests {
+		status, body := assertionTokens(t, ts, test.assertion)
+		if test.wantOK && status != http.StatusOK {
+			t.Errorf("%s: status %d: %v; want %d", test.name, status, body, http.StatusOK)
+		}
+		if !test.wantOK && (status != http.StatusUnauthorized || body["error"] != "invalid_client") {
+			t.Errorf("%s: status %d: %v; want %d, invalid_client", test.name, status, body, http.StatusUnauthorized)
+		}
+	}
+
+	// A client restricted to another method cannot use it.
+	c.SetTokenEndpointAuthMethod("private_key_jwt")
+	if status, body := assertionTokens(t, ts, hs256JWT(longSecret, assertionClaims(ts, nil))); status != http.StatusUnauthorized {
+		t.Errorf("client_secret_jwt with private_key_jwt registered: status %d: %v; want %d", status, body, http.StatusUnauthorized)
+	}
+	c.SetTokenEndpointAuthMethod("client_secret_jwt")
+	if status, body := postForm(t, ts, "/token", codeParams(t, ts, "openid")); status != http.StatusUnauthorized {
+		t.Errorf("client_secret_post with client_secret_jwt registered: status %d: %v; want %d", status, body, http.StatusUnauthorized)
+	}
+}
+
+func TestRegisteredClientSecretJWT(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetOpenRegistration(true)
+
+	status, client := register(t, ts.URL, map[string]any{
+		"redirect_uris":              []string{testRedirectURI},
+		"token_endpoint_auth_method": "client_secret_jwt",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("registration: status %d: %v", status, client)
+	}
+	secret, _ := client["client_secret"].(string)
+	if len(secret) < 64 {
+		t.Errorf("registered client has a secret of %d bytes; want at least 64, for HS512", len(secret))
+	}
+}
@@ -0,0 +1,119 @@
+package jambo
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// Client authentication methods
+// (https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication):
+const (
+	authMethodSecretBasic   = "client_secret_basic"
+	authMethodSecretPost    = "client_secret_post"
+	authMethodSecretJWT     = "client_secret_jwt"
+	authMethodPrivateKeyJWT = "private_key_jwt"
+)
+
+var authMethodsSupported = []string{
+	authMethodSecretBasic,
+	authMethodSecretPost,
+	authMethodSecretJWT,
+	authMethodPrivateKeyJWT,
+	authMethodTLSClientAuth,
+	authMethodSelfSignedTLSClientAuth,
+}
+
+// SetTokenEndpointAuthMethod sets the only method a client can use to authenticate
+// itself ("client_secret_basic", "client_secret_post", "client_secret_jwt",
+// "private_key_jwt", "tls_client_auth" or "self_signed_tls_client_auth").
+// "client_secret_basic" and "client_secret_post" are interchangeable.
+// By default, a client can use any method.
+//
+// With "client_secret_jwt", the secrets must be kept in plain text, and they must be
+// at least as long as the hash of the algorithm used (32 bytes for HS256, 48 for HS384
+// and 64 for HS512); the ones which are not are not accepted with this method.
+func (c *Client) SetTokenEndpointAuthMethod(method string) {
+	c.tokenEndpointAuthMethod = method
+}
+
+// authenticateClient checks the credentials sent by a client to the token,
+// introspection or revocation endpoints, and returns the client.  If they
+// are not valid, it sends an error response and returns nil.
+func (s *Server) authenticateClient(w http.ResponseWriter, r *http.Request) *Client {
+	if assertionType := r.PostFormValue("client_assertion_type"); assertionType != "" {
+		return s.authenticateClientAssertion(w, r, assertionType)
+	}
+
+	// client_id and client_secret can be sent using HTTP Basic Authentication per RFC 6749, section 2.3.1
+	method := authMethodSecretBasic
+	clientID, clientSecret, ok := r.BasicAuth()
+	if cert := clientCertificate(r); cert != nil && !ok && !r.PostForm.Has("client_secret") {
+		return s.authenticateClientCertificate(w, r, cert)
+	}
+	if ok {
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			if _DEBUG {
+				log.Printf("%s %s %s: invalid client_id\n", r.RemoteAddr, r.Method, r.URL.Path)
+			}
+			writeJSONError(w, http.StatusBadRequest, "invalid_request", "client_id improperly encoded")
+			return nil
+		}
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			if _DEBUG {
+				log.Printf("%s %s %s: invalid client_secret\n", r.RemoteAddr, r.Method, r.URL.Path)
+			}
+			writeJSONError(w, http.StatusBadRequest, "invalid_request", "client_secret improperly encoded")
+			return nil
+		}
+	} else {
+		method = authMethodSecretPost
+		clientID = r.PostFormValue("client_id")
+		clientSecret = r.PostFormValue("client_secret")
+	}
+
+	client := s.findClient(clientID)
+	var secret *ClientSecret
+	if client != nil && client.allowsAuthMethod(method) {
+		secret = client.checkSecret(clientSecret)
+	}
+	if secret == nil {
+		if _DEBUG {
+			log.Printf("%s %s %s: invalid credentials for client_id=%q\n", r.RemoteAddr, r.Method, r.URL.Path, clientID)
+		}
+		if ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="jambo"`)
+		}
+		writeJSONError(w, http.StatusUnauthorized, "invalid_client", "Invalid client credentials.")
+		return nil
+	}
+	s.recordSecretUse(client, secret)
+	return client
+}
+
+// authenticateClientAssertion checks a client assertion ("private_key_jwt" or "client_secret_jwt").
+func (s *Server) authenticateClientAssertion(w http.ResponseWriter, r *http.Request, assertionType string) *Client {
+	if assertionType != clientAssertionTypeJWT {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "Unsupported client_assertion_type.")
+		return nil
+	}
+
+	client, method, err := s.verifyClientAssertion(r, r.PostFormValue("client_assertion"))
+	if err == nil {
+		if clientID := r.PostFormValue("client_id"); clientID != "" && clientID != client.id {
+			err = errors.New("client_id does not match the assertion")
+		} else if !client.allowsAuthMethod(method) {
+			err = errors.New("authentication method " + method + " not allowed")
+		}
+	}
+	if err != nil {
+		if _DEBUG {
+			log.Printf("%s %s %s: invalid client assertion: %v\n", r.RemoteAddr, r.Method, r.URL.Path, err)
+		}
+		writeJSONError(w, http.StatusUnauthorized, "invalid_client", "Invalid client assertion.")
+		return nil
+	}
+	return client
+}
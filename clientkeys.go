@@ -0,0 +1,96 @@
+package jambo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	jwksCacheLifetime = 5 * time.Minute  // time the keys fetched from a "jwks_uri" are kept
+	jwksMinRefresh    = 30 * time.Second // minimum time between fetches of the same "jwks_uri"
+	jwksMaxSize       = 1 << 20          // maximum size of a JWK Set fetched from a "jwks_uri"
+)
+
+// cachedJWKS is a JWK Set fetched from the "jwks_uri" of a client.
+type cachedJWKS struct {
+	keys    jose.JSONWebKeySet
+	fetched time.Time
+}
+
+// SetJWKS sets the public keys used by a client to sign its JWTs
+// (for the "private_key_jwt" authentication method).
+func (c *Client) SetJWKS(jwks jose.JSONWebKeySet) {
+	c.jwks = jwks
+}
+
+// SetJWKSURI sets the URL where the server can get the public keys used by a client
+// to sign its JWTs (for the "private_key_jwt" authentication method).
+// It takes precedence over the keys set with SetJWKS.
+func (c *Client) SetJWKSURI(uri string) {
+	c.jwksURI = uri
+}
+
+// selectKeys returns the public signing keys from a JWK Set with a given key ID,
+// or all of them if kid is empty.
+func selectKeys(jwks jose.JSONWebKeySet, kid string) []jose.JSONWebKey {
+	var keys []jose.JSONWebKey
+	for _, key := range jwks.Keys {
+		if (kid != "" && key.KeyID != kid) || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		if pub := key.Public(); pub.Valid() {
+			keys = append(keys, pub)
+		}
+	}
+	return keys
+}
+
+// clientKeys returns the public keys of a client with a given key ID
+// (or all of them, if kid is empty), from its "jwks_uri" or its "jwks".
+func (s *Server) clientKeys(c *Client, kid string) ([]jose.JSONWebKey, error) {
+	if c.jwksURI == "" {
+		return selectKeys(c.jwks, kid), nil
+	}
+
+	s.Lock()
+	cached, ok := s.jwksCache[c.jwksURI]
+	s.Unlock()
+	if ok && time.Since(cached.fetched) < jwksCacheLifetime {
+		// If the key is not found, the client may have rotated its keys.
+		keys := selectKeys(cached.keys, kid)
+		if len(keys) > 0 || time.Since(cached.fetched) < jwksMinRefresh {
+			return keys, nil
+		}
+	}
+
+	jwks, err := s.fetchJWKS(c.jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	s.jwksCache[c.jwksURI] = cachedJWKS{keys: jwks, fetched: time.Now()}
+	s.Unlock()
+	return selectKeys(jwks, kid), nil
+}
+
+// fetchJWKS gets a JWK Set from a URL.
+func (s *Server) fetchJWKS(uri string) (jose.JSONWebKeySet, error) {
+	var jwks jose.JSONWebKeySet
+	resp, err := s.httpClient.Get(uri)
+	if err != nil {
+		return jwks, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jwks, fmt.Errorf("jwks_uri %s: %s", uri, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxSize)).Decode(&jwks); err != nil {
+		return jwks, fmt.Errorf("jwks_uri %s: %w", uri, err)
+	}
+	return jwks, nil
+}
@@ -0,0 +1,138 @@
+package jambo
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// A ClientSecret is one of the secrets a client can use to authenticate itself.
+// A client can have several secrets at the same time, which lets it rotate them
+// without a hard cut-over: a new secret is added, the client starts using it,
+// and the old one expires.
+type ClientSecret struct {
+	// Secret is kept in plain text, or as a hash made with [HashSecret].
+	Secret string `json:"secret"`
+
+	// NotAfter is the time after which the secret is no longer accepted.
+	// It is zero if the secret does not expire.
+	NotAfter time.Time `json:"not_after,omitzero"`
+
+	// LastUsed is the last time the secret was used to authenticate the client.
+	// It is not part of the client; it is kept in the Storage of the server
+	// (see [Server.ClientSecrets]).
+	LastUsed time.Time `json:"-"`
+}
+
+// expired reports whether a secret is no longer accepted.
+func (cs ClientSecret) expired(now time.Time) bool {
+	return !cs.NotAfter.IsZero() && now.After(cs.NotAfter)
+}
+
+// hashed reports whether a secret is kept as a hash.
+func (cs ClientSecret) hashed() bool {
+	return strings.HasPrefix(cs.Secret, "$")
+}
+
+// id returns an identifier of a secret, used to record when it was used.
+func (cs ClientSecret) id() string {
+	return hashToken(cs.Secret)[:16]
+}
+
+// AddSecret adds a secret to a client, which will be accepted until notAfter
+// (or forever, if notAfter is zero).  The secret can be given in plain text
+// or as a hash made with [HashSecret].
+func (c *Client) AddSecret(secret string, notAfter time.Time) {
+	c.secrets = append(c.secrets, ClientSecret{Secret: secret, NotAfter: notAfter})
+}
+
+// ExpireSecrets sets the time after which the current secrets of a client will no
+// longer be accepted, unless they already expire before that.  To rotate the secret
+// of a client, call ExpireSecrets with a grace period and then add the new secret.
+func (c *Client) ExpireSecrets(notAfter time.Time) {
+	for i := range c.secrets {
+		if c.secrets[i].NotAfter.IsZero() || c.secrets[i].NotAfter.After(notAfter) {
+			c.secrets[i].NotAfter = notAfter
+		}
+	}
+}
+
+// RemoveExpiredSecrets removes the secrets which are no longer accepted.
+func (c *Client) RemoveExpiredSecrets() {
+	now := time.Now()
+	secrets := c.secrets[:0]
+	for _, cs := range c.secrets {
+		if !cs.expired(now) {
+			secrets = append(secrets, cs)
+		}
+	}
+	c.secrets = secrets
+}
+
+// checkSecret returns the secret of a client which matches the one sent by it,
+// or nil if there is none.  Expired secrets are not accepted.
+func (c *Client) checkSecret(secret string) *ClientSecret {
+	now := time.Now()
+	var found *ClientSecret
+	for i, cs := range c.secrets {
+		// Every secret is checked, so the time taken does not depend on which one matches.
+		if verifySecret(cs.Secret, secret) && !cs.expired(now) && found == nil {
+			found = &c.secrets[i]
+		}
+	}
+	return found
+}
+
+// secretExpiresAt returns the time at which the last of the secrets of
+// a client expires, as used in "client_secret_expires_at": seconds from
+// the Unix epoch, or 0 if it does not expire.
+func (c *Client) secretExpiresAt() int64 {
+	var last time.Time
+	for _, cs := range c.secrets {
+		if cs.NotAfter.IsZero() {
+			return 0
+		}
+		if cs.NotAfter.After(last) {
+			last = cs.NotAfter
+		}
+	}
+	if last.IsZero() {
+		return 0
+	}
+	return last.Unix()
+}
+
+// plainSecret returns the newest secret of a client which is not hashed and has
+// not expired, to be sent back to a registered client, or "" if there is none.
+func (c *Client) plainSecret() string {
+	now := time.Now()
+	for _, cs := range slices.Backward(c.secrets) {
+		if !cs.hashed() && !cs.expired(now) {
+			return cs.Secret
+		}
+	}
+	return ""
+}
+
+// secretLastUsedLifetime is the time the last use of a secret is remembered.
+const secretLastUsedLifetime = 365 * 24 * time.Hour
+
+// recordSecretUse records in the Storage that a secret has been used.
+func (s *Server) recordSecretUse(c *Client, cs *ClientSecret) {
+	now := time.Now().UTC()
+	s.storage.Put(bucketSecretUses, c.id+" "+cs.id(), []byte(now.Format(time.RFC3339)), now.Add(secretLastUsedLifetime))
+}
+
+// ClientSecrets returns the secrets of a client, including the expired ones,
+// with the last time each of them was used (if it has been used since
+// the server started, or if the Storage keeps it).
+func (s *Server) ClientSecrets(c *Client) []ClientSecret {
+	secrets := make([]ClientSecret, len(c.secrets))
+	for i, cs := range c.secrets {
+		secrets[i] = cs
+		if data, err := s.storage.Get(bucketSecretUses, c.id+" "+cs.id()); err == nil {
+			secrets[i].LastUsed, _ = time.Parse(time.RFC3339, string(data))
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,180 @@
+package jambo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrClientNotFound is returned by a [ClientStore] when the requested client does not exist.
+var ErrClientNotFound = errors.New("client not found")
+
+// A ClientStore keeps the list of clients known to a Server.
+// All its methods can be called concurrently.
+type ClientStore interface {
+	// Client returns the client with a given ID, or ErrClientNotFound.
+	Client(id string) (*Client, error)
+
+	// Clients returns all the clients in the store.
+	Clients() ([]*Client, error)
+
+	// CreateClient adds a new client to the store.
+	CreateClient(c *Client) error
+
+	// UpdateClient replaces an existing client (with the same ID) in the store.
+	UpdateClient(c *Client) error
+
+	// DeleteClient removes a client from the store.
+	DeleteClient(id string) error
+}
+
+// SetClientStore sets the store used to keep the clients.
+// By default, the clients are kept in memory (see [NewMemoryClientStore]).
+func (s *Server) SetClientStore(store ClientStore) {
+	s.clients = store
+}
+
+// ID returns the client identifier.
+func (c *Client) ID() string {
+	return c.id
+}
+
+// clientJSON is the representation of a client used by MarshalJSON and UnmarshalJSON.
+// It uses the registration metadata, plus a few settings specific to this server.
+type clientJSON struct {
+	ClientID                string         `json:"client_id"`
+	ClientSecret            string         `json:"client_secret,omitempty"`
+	ClientSecrets           []ClientSecret `json:"client_secrets,omitempty"` // if there are several, or they expire
+	RegistrationAccessToken string         `json:"registration_access_token_hash,omitempty"`
+	clientMetadata
+	AllowedRoles   []string `json:"allowed_roles,omitempty"`
+	RequireConsent bool     `json:"require_consent,omitempty"`
+	MinimumACR     string   `json:"minimum_acr,omitempty"`
+
+	TLSClientCertThumbprints []string `json:"tls_client_certificate_thumbprints,omitempty"` // for self_signed_tls_client_auth
+
+	APIResources map[string][]string `json:"api_resources,omitempty"` // granted scopes, by identifier
+}
+
+// MarshalJSON returns the JSON encoding of a client, used to keep it in
+// a [ClientStore].  It uses the field names of the Dynamic Client Registration
+// metadata (such as "client_id" or "redirect_uris") where possible.
+func (c *Client) MarshalJSON() ([]byte, error) {
+	cj := clientJSON{
+		ClientID:                c.id,
+		RegistrationAccessToken: c.registrationAccessToken,
+		clientMetadata:          c.metadata(),
+		AllowedRoles:            c.allowedRoles,
+		RequireConsent:          c.requireConsent,
+		MinimumACR:              c.minimumACR,
+
+		TLSClientCertThumbprints: c.tlsClientCertThumbprints,
+
+		APIResources: c.apiResources,
+	}
+	if len(c.secrets) == 1 && c.secrets[0].NotAfter.IsZero() {
+		cj.ClientSecret = c.secrets[0].Secret
+	} else {
+		cj.ClientSecrets = c.secrets
+	}
+	return json.Marshal(cj)
+}
+
+// UnmarshalJSON sets the content of a client from its JSON encoding.
+func (c *Client) UnmarshalJSON(data []byte) error {
+	var cj clientJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+	if cj.ClientID == "" {
+		return fmt.Errorf("client without client_id")
+	}
+	*c = Client{
+		id:                      cj.ClientID,
+		secrets:                 cj.ClientSecrets,
+		registrationAccessToken: cj.RegistrationAccessToken,
+		allowedRoles:            cj.AllowedRoles,
+		requireConsent:          cj.RequireConsent,
+		minimumACR:              cj.MinimumACR,
+
+		tlsClientCertThumbprints: cj.TLSClientCertThumbprints,
+
+		apiResources: cj.APIResources,
+	}
+	if cj.ClientSecret != "" {
+		c.secrets = append([]ClientSecret{{Secret: cj.ClientSecret}}, c.secrets...)
+	}
+	c.setMetadata(cj.clientMetadata)
+	return nil
+}
+
+// memoryClientStore is a ClientStore which keeps the clients in memory.
+type memoryClientStore struct {
+	sync.RWMutex
+	clients []*Client
+}
+
+// NewMemoryClientStore returns a [ClientStore] which keeps the clients in memory.
+// The clients are stored as pointers, so they can be modified after being added.
+func NewMemoryClientStore() ClientStore {
+	return &memoryClientStore{}
+}
+
+func (m *memoryClientStore) Client(id string) (*Client, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, c := range m.clients {
+		if c.id == id {
+			return c, nil
+		}
+	}
+	return nil, ErrClientNotFound
+}
+
+func (m *memoryClientStore) Clients() ([]*Client, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	return append([]*Client(nil), m.clients...), nil
+}
+
+func (m *memoryClientStore) CreateClient(c *Client) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, other := range m.clients {
+		if other.id == c.id {
+			return fmt.Errorf("client %q already exists", c.id)
+		}
+	}
+	m.clients = append(m.clients, c)
+	return nil
+}
+
+func (m *memoryClientStore) UpdateClient(c *Client) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for i, other := range m.clients {
+		if other.id == c.id {
+			m.clients[i] = c
+			return nil
+		}
+	}
+	return ErrClientNotFound
+}
+
+func (m *memoryClientStore) DeleteClient(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for i, c := range m.clients {
+		if c.id == id {
+			m.clients = append(m.clients[:i], m.clients[i+1:]...)
+			return nil
+		}
+	}
+	return ErrClientNotFound
+}
@@ -0,0 +1,43 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cespedes/jambo"
+	"github.com/cespedes/jambo/storagetest"
+)
+
+func TestClientJSONScopes(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := s.NewClient("scoped-client", testClientSecret)
+	c.AddAllowedScopes("billing:read")
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded jambo.Client
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	data, err = json.Marshal(&loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata struct {
+		Scope string `json:"scope"`
+	}
+	json.Unmarshal(data, &metadata)
+	if !slices.Contains(strings.Fields(metadata.Scope), "billing:read") {
+		t.Errorf("reloaded client has scope %q; want it to include billing:read", metadata.Scope)
+	}
+}
+
+func TestMemoryClientStore(t *testing.T) {
+	if err := storagetest.TestClientStore(jambo.NewMemoryClientStore()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cespedes/jambo"
+)
+
+// hashSecret prints the hash of a client secret, to be used in a configuration file.
+// The secret is read from the command line or, if it is not there, from the standard input.
+func hashSecret(args []string) error {
+	var algorithm string
+
+	flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-algorithm name] [secret]\n", args[0])
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&algorithm, "algorithm", jambo.SecretHashArgon2id,
+		fmt.Sprintf("Hash algorithm (%s, %s or %s).", jambo.SecretHashArgon2id, jambo.SecretHashBcrypt, jambo.SecretHashPBKDF2))
+	flags.Parse(args[1:])
+
+	var secret string
+	switch flags.NArg() {
+	case 0:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading secret: %w", err)
+		}
+		secret = strings.TrimRight(line, "\r\n")
+	case 1:
+		secret = flags.Arg(0)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if secret == "" {
+		return errors.New("empty secret")
+	}
+
+	hash, err := jambo.HashSecret(secret, algorithm)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cespedes/jambo"
+)
+
+// runHashSecret runs the hash-secret command with some arguments and a standard input,
+// and returns what it prints.
+func runHashSecret(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inR, outW
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	io.WriteString(inW, stdin)
+	inW.Close()
+	err = run(append([]string{"oidc-server", "hash-secret"}, args...))
+	outW.Close()
+	out, _ := io.ReadAll(outR)
+	return string(out), err
+}
+
+func TestHashSecret(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	s := jambo.NewServer(ts.URL+"/oidc", "/oidc")
+	mux.Handle("/oidc/", s)
+
+	tests := []struct {
+		args  []string
+		stdin string
+	}{
+		{nil, "my-secret\n"},
+		{[]string{"my-secret"}, ""},
+		{[]string{"-algorithm", jambo.SecretHashBcrypt, "my-secret"}, ""},
+		{[]string{"-algorithm", jambo.SecretHashPBKDF2}, "my-secret\r\n"},
+	}
+	for i, test := range tests {
+		out, err := runHashSecret(t, test.stdin, test.args...)
+		if err != nil {
+			t.Errorf("hash-secret %v: %v", test.args, err)
+			continue
+		}
+		hash := strings.TrimSuffix(out, "\n")
+		if !strings.HasPrefix(hash, "$") || strings.Contains(hash, "my-secret") {
+			t.Errorf("hash-secret %v printed %q; want a hash", test.args, out)
+			continue
+		}
+
+		// The printed hash can be used as the secret of a client.
+		clientID := string(rune('a' + i))
+		s.NewClient(clientID, hash)
+		resp, err := ts.Client().PostForm(ts.URL+"/oidc/introspect", url.Values{
+			"client_id":     {clientID},
+			"client_secret": {"my-secret"},
+			"token":         {"token"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("hash-secret %v: client with hash %q not authenticated (status %d)", test.args, hash, resp.StatusCode)
+		}
+	}
+
+	for _, args := range [][]string{{"-algorithm", "md5", "my-secret"}, {""}} {
+		if out, err := runHashSecret(t, "", args...); err == nil {
+			t.Errorf("hash-secret %q printed %q; want an error", args, out)
+		}
+	}
+	if out, err := runHashSecret(t, ""); err == nil {
+		t.Errorf("hash-secret with no input printed %q; want an error", out)
+	}
+}
@@ -17,6 +17,10 @@ func main() {
 }
 
 func run(args []string) error {
+	if len(args) > 1 && args[1] == "hash-secret" {
+		return hashSecret(args[1:])
+	}
+
 	var issuer string
 
 	flags := flag.NewFlagSet(args[0], flag.ExitOnError)
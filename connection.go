@@ -0,0 +1,131 @@
+package jambo
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// connectionLifetime is the time a login session or an authorization code
+// is kept in the Storage after its last change.
+const connectionLifetime = 10 * time.Minute
+
+// connectionJSON is the representation of a Connection kept in the Storage.
+type connectionJSON struct {
+	Code         string         `json:"code"`
+	ClientID     string         `json:"client_id"`
+	RedirectURI  string         `json:"redirect_uri"`
+	State        string         `json:"state,omitempty"`
+	Nonce        string         `json:"nonce,omitempty"`
+	Scopes       []string       `json:"scopes,omitempty"`
+	Claims       *ClaimsRequest `json:"claims,omitempty"`
+	Prompt       []string       `json:"prompt,omitempty"`
+	MaxAge       int            `json:"max_age"`
+	ACRValues    []string       `json:"acr_values,omitempty"`
+	LoginHint    string         `json:"login_hint,omitempty"`
+	IDTokenHint  string         `json:"id_token_hint,omitempty"`
+	Response     Response       `json:"response"`
+	AuthTime     time.Time      `json:"auth_time"`
+	SID          string         `json:"sid,omitempty"`
+	Consented    bool           `json:"consented,omitempty"`
+	Authorized   bool           `json:"authorized,omitempty"`
+	DPoPJKT      string         `json:"dpop_jkt,omitempty"`
+	ResponseType string         `json:"response_type,omitempty"`
+	ResponseMode string         `json:"response_mode,omitempty"`
+	Resources    []string       `json:"resources,omitempty"`
+}
+
+func (conn *Connection) marshal() ([]byte, error) {
+	return json.Marshal(connectionJSON{
+		Code:         conn.code,
+		ClientID:     conn.client.id,
+		RedirectURI:  conn.redirectURI,
+		State:        conn.state,
+		Nonce:        conn.nonce,
+		Scopes:       conn.scopes,
+		Claims:       conn.claims,
+		Prompt:       conn.prompt,
+		MaxAge:       conn.maxAge,
+		ACRValues:    conn.acrValues,
+		LoginHint:    conn.loginHint,
+		IDTokenHint:  conn.idTokenHint,
+		Response:     conn.response,
+		AuthTime:     conn.authTime,
+		SID:          conn.sid,
+		Consented:    conn.consented,
+		Authorized:   conn.authorized,
+		DPoPJKT:      conn.dpopJKT,
+		ResponseType: conn.responseType,
+		ResponseMode: conn.responseMode,
+		Resources:    conn.resources,
+	})
+}
+
+// unmarshalConnection decodes a Connection kept in the Storage.
+// It returns nil if it cannot be decoded, or if its client no longer exists.
+func (s *Server) unmarshalConnection(data []byte) *Connection {
+	var cj connectionJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return nil
+	}
+	client := s.findClient(cj.ClientID)
+	if client == nil {
+		return nil
+	}
+	return &Connection{
+		code:         cj.Code,
+		client:       client,
+		redirectURI:  cj.RedirectURI,
+		state:        cj.State,
+		nonce:        cj.Nonce,
+		scopes:       cj.Scopes,
+		claims:       cj.Claims,
+		prompt:       cj.Prompt,
+		maxAge:       cj.MaxAge,
+		acrValues:    cj.ACRValues,
+		loginHint:    cj.LoginHint,
+		idTokenHint:  cj.IDTokenHint,
+		response:     cj.Response,
+		authTime:     cj.AuthTime,
+		sid:          cj.SID,
+		consented:    cj.Consented,
+		authorized:   cj.Authorized,
+		dpopJKT:      cj.DPoPJKT,
+		responseType: cj.ResponseType,
+		responseMode: cj.ResponseMode,
+		resources:    cj.Resources,
+	}
+}
+
+// saveConnection stores a login session (or, once the user has been
+// authorized, its authorization code) in the Storage.
+func (s *Server) saveConnection(conn *Connection) error {
+	data, err := conn.marshal()
+	if err != nil {
+		return err
+	}
+	return s.storage.Put(bucketConnections, conn.code, data, time.Now().Add(connectionLifetime))
+}
+
+// loadConnection returns the login session with a given code, or nil if it does not exist.
+func (s *Server) loadConnection(code string) *Connection {
+	data, err := s.storage.Get(bucketConnections, code)
+	if err != nil {
+		return nil
+	}
+	return s.unmarshalConnection(data)
+}
+
+// takeConnection is like loadConnection, but it also removes the login session,
+// so that an authorization code can only be used once.
+func (s *Server) takeConnection(code string) *Connection {
+	data, err := s.storage.Take(bucketConnections, code)
+	if err != nil {
+		return nil
+	}
+	return s.unmarshalConnection(data)
+}
+
+// deleteConnection removes a login session from the Storage.
+func (s *Server) deleteConnection(code string) {
+	s.storage.Delete(bucketConnections, code)
+}
@@ -13,6 +13,8 @@ const (
 	scopeEmail   = "email"
 	scopeProfile = "profile"
 	scopeGroups  = "groups"
+
+	scopeOfflineAccess = "offline_access" // ask for a refresh token
 )
 
 var scopesSupported = []string{
@@ -20,24 +22,51 @@ var scopesSupported = []string{
 	scopeEmail,
 	scopeProfile,
 	scopeGroups,
+	scopeOfflineAccess,
 }
 
 type openidConfiguration struct {
-	Issuer                            string   `json:"issuer"`                                // REQUIRED
-	AuthorizationEndpoint             string   `json:"authorization_endpoint"`                // REQUIRED
-	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`              // REQUIRED unless only implicit flow
-	UserInfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`           // recommended
-	JwksURI                           string   `json:"jwks_uri"`                              // REQUIRED
-	RegistrationEndpoint              string   `json:"registration_endpoint,omitempty"`       // recommended
-	ScopesSupported                   []string `json:"scopes_supported,omitempty"`            // recommended
-	ResponseTypesSupported            []string `json:"response_types_supported"`              // REQUIRED
-	ResponseModesSupported            []string `json:"response_modes_supported,omitempty"`    // optional
-	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`       // optional
-	ACRValuesSupported                []string `json:"acr_values_supported,omitempty"`        // optional
-	SubjectTypesSupported             []string `json:"subject_types_supported"`               // REQUIRED
-	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"` // REQUIRED
-	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"` // optional
-	ClaimsSupported                   []string `json:"claims_supported,omitempty"`            // recommended
+	Issuer                                             string   `json:"issuer"`                                // REQUIRED
+	AuthorizationEndpoint                              string   `json:"authorization_endpoint"`                // REQUIRED
+	TokenEndpoint                                      string   `json:"token_endpoint,omitempty"`              // REQUIRED unless only implicit flow
+	UserInfoEndpoint                                   string   `json:"userinfo_endpoint,omitempty"`           // recommended
+	JwksURI                                            string   `json:"jwks_uri"`                              // REQUIRED
+	RevocationEndpoint                                 string   `json:"revocation_endpoint,omitempty"`         // RFC 7009
+	IntrospectionEndpoint                              string   `json:"introspection_endpoint,omitempty"`      // RFC 7662
+	RegistrationEndpoint                               string   `json:"registration_endpoint,omitempty"`       // recommended
+	EndSessionEndpoint                                 string   `json:"end_session_endpoint,omitempty"`        // RP-initiated logout
+	CheckSessionIframe                                 string   `json:"check_session_iframe,omitempty"`        // session management
+	ScopesSupported                                    []string `json:"scopes_supported,omitempty"`            // recommended
+	ResponseTypesSupported                             []string `json:"response_types_supported"`              // REQUIRED
+	ResponseModesSupported                             []string `json:"response_modes_supported,omitempty"`    // optional
+	GrantTypesSupported                                []string `json:"grant_types_supported,omitempty"`       // optional
+	ACRValuesSupported                                 []string `json:"acr_values_supported,omitempty"`        // optional
+	SubjectTypesSupported                              []string `json:"subject_types_supported"`               // REQUIRED
+	IDTokenSigningAlgValuesSupported                   []string `json:"id_token_signing_alg_values_supported"` // REQUIRED
+	TokenEndpointAuthMethodsSupported                  []string `json:"token_endpoint_auth_methods_supported"` // optional
+	TokenEndpointAuthSigningAlgValuesSupported         []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	RevocationEndpointAuthMethodsSupported             []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthSigningAlgValuesSupported    []string `json:"revocation_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported          []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	IntrospectionEndpointAuthSigningAlgValuesSupported []string `json:"introspection_endpoint_auth_signing_alg_values_supported,omitempty"`
+	AuthorizationResponseISSParameterSupported         bool     `json:"authorization_response_iss_parameter_supported,omitempty"`
+	ClaimsSupported                                    []string `json:"claims_supported,omitempty"`                           // recommended
+	TLSClientCertificateBoundAccessTokens              bool     `json:"tls_client_certificate_bound_access_tokens,omitempty"` // RFC 8705
+	DPoPSigningAlgValuesSupported                      []string `json:"dpop_signing_alg_values_supported,omitempty"`          // RFC 9449
+	PushedAuthorizationRequestEndpoint                 string   `json:"pushed_authorization_request_endpoint,omitempty"`      // RFC 9126
+	ClaimsParameterSupported                           bool     `json:"claims_parameter_supported,omitempty"`                 // optional
+	BackchannelLogoutSupported                         bool     `json:"backchannel_logout_supported,omitempty"`
+	BackchannelLogoutSessionSupported                  bool     `json:"backchannel_logout_session_supported,omitempty"`
+	FrontchannelLogoutSupported                        bool     `json:"frontchannel_logout_supported,omitempty"`
+	FrontchannelLogoutSessionSupported                 bool     `json:"frontchannel_logout_session_supported,omitempty"`
+
+	RequestParameterSupported                 bool     `json:"request_parameter_supported,omitempty"` // RFC 9101
+	RequestURIParameterSupported              bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration             bool     `json:"require_request_uri_registration,omitempty"`
+	RequestObjectSigningAlgValuesSupported    []string `json:"request_object_signing_alg_values_supported,omitempty"`
+	RequestObjectEncryptionAlgValuesSupported []string `json:"request_object_encryption_alg_values_supported,omitempty"`
+	RequestObjectEncryptionEncValuesSupported []string `json:"request_object_encryption_enc_values_supported,omitempty"`
+	AuthorizationSigningAlgValuesSupported    []string `json:"authorization_signing_alg_values_supported,omitempty"` // JARM
 	// missing a lot of "optional" fields
 }
 
@@ -48,25 +77,62 @@ func (s *Server) openIDConfiguration(w http.ResponseWriter, r *http.Request) {
 		TokenEndpoint:                     s.issuer + "/token",
 		JwksURI:                           s.issuer + "/keys",
 		UserInfoEndpoint:                  s.issuer + "/userinfo",
+		RevocationEndpoint:                s.issuer + "/revoke",
+		IntrospectionEndpoint:             s.issuer + "/introspect",
+		EndSessionEndpoint:                s.issuer + "/logout",
+		CheckSessionIframe:                s.issuer + "/check_session.html",
 		ScopesSupported:                   scopesSupported,
-		ResponseTypesSupported:            []string{"code"},
-		GrantTypesSupported:               []string{"authorization_code"},
+		ACRValuesSupported:                s.acrValues,
+		ResponseTypesSupported:            responseTypesSupported,
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeImplicit},
 		SubjectTypesSupported:             []string{"public"},
 		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		TokenEndpointAuthMethodsSupported: authMethodsSupported,
+		TokenEndpointAuthSigningAlgValuesSupported:         algNames(assertionKeyAlgs, assertionSecretAlgs),
+		RevocationEndpointAuthMethodsSupported:             authMethodsSupported,
+		RevocationEndpointAuthSigningAlgValuesSupported:    algNames(assertionKeyAlgs, assertionSecretAlgs),
+		IntrospectionEndpointAuthMethodsSupported:          authMethodsSupported,
+		IntrospectionEndpointAuthSigningAlgValuesSupported: algNames(assertionKeyAlgs, assertionSecretAlgs),
+		AuthorizationResponseISSParameterSupported:         true,
+		ResponseModesSupported:                             responseModesSupported,
 		ClaimsSupported: []string{
 			// Required claims:
-			"iss", // Issuer.
-			"sub", // Subject.
-			"aud", // Audience.
-			"exp", // Expiration time after which the JWT MUST NOT be accepted for processing.
-			"iat", // Time at which the JWT was issued.
+			"iss",       // Issuer.
+			"sub",       // Subject.
+			"aud",       // Audience.
+			"exp",       // Expiration time after which the JWT MUST NOT be accepted for processing.
+			"iat",       // Time at which the JWT was issued.
+			"auth_time", // Time when the End-User authentication occurred.
+			"acr",       // Authentication Context Class Reference.
+			"amr",       // Authentication Methods References.
+			"sid",       // Session ID.
 			// User profile claims:
 			"name",               // Full name
 			"email",              // Preferred e-mail address
+			"email_verified",     // True if the e-mail address has been verified
 			"preferred_username", // Shorthand name by which the End-User wishes to be referred to.
 			// "jti",                // JWT ID.  A unique identifier for the token.
 		},
+		ClaimsParameterSupported:              true,
+		TLSClientCertificateBoundAccessTokens: true,
+		DPoPSigningAlgValuesSupported:         algNames(dpopAlgs),
+		PushedAuthorizationRequestEndpoint:    s.issuer + "/par",
+		BackchannelLogoutSupported:            true,
+		BackchannelLogoutSessionSupported:     true,
+		FrontchannelLogoutSupported:           true,
+		FrontchannelLogoutSessionSupported:    true,
+
+		RequestParameterSupported:                 true,
+		RequestURIParameterSupported:              true,
+		RequireRequestURIRegistration:             true,
+		RequestObjectSigningAlgValuesSupported:    algNames(requestObjectSigningAlgs),
+		RequestObjectEncryptionAlgValuesSupported: algNames(requestObjectKeyAlgs),
+		RequestObjectEncryptionEncValuesSupported: algNames(requestObjectContentEncs),
+		AuthorizationSigningAlgValuesSupported:    algNames(authorizationSigningAlgs),
+	}
+
+	if s.registrationEnabled() {
+		config.RegistrationEndpoint = s.issuer + "/register"
 	}
 
 	data, err := json.MarshalIndent(config, "", "  ")
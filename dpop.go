@@ -0,0 +1,192 @@
+package jambo
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// DPoP (Demonstrating Proof of Possession, RFC 9449):
+const (
+	dpopHeader      = "DPoP"       // header with the proof
+	dpopNonceHeader = "DPoP-Nonce" // header with a nonce to use in the next proof
+	dpopJWTType     = "dpop+jwt"   // "typ" of the proofs
+	tokenTypeDPoP   = "DPoP"       // "token_type" of the bound access tokens
+
+	dpopProofLifetime = 5 * time.Minute // maximum age of a proof
+	dpopNonceLifetime = 5 * time.Minute // time a nonce can be used
+)
+
+// dpopAlgs are the algorithms accepted in DPoP proofs.
+var dpopAlgs = assertionKeyAlgs
+
+// errUseDPoPNonce is returned when a DPoP proof does not have a valid nonce.
+var errUseDPoPNonce = errors.New("a valid DPoP nonce is required")
+
+// dpopClaims are the claims of a DPoP proof (RFC 9449, section 4.2).
+type dpopClaims struct {
+	ID       string           `json:"jti"`
+	Method   string           `json:"htm"`
+	URI      string           `json:"htu"`
+	IssuedAt *jwt.NumericDate `json:"iat"`
+	Nonce    string           `json:"nonce,omitempty"`
+	ATH      string           `json:"ath,omitempty"` // hash of the access token
+}
+
+// SetDPoPNonceRequired specifies whether the DPoP proofs sent to the server must have
+// a nonce issued by the server (RFC 9449, section 8).  Nonces are sent to the clients
+// in the "DPoP-Nonce" header of the responses, and they limit the time a proof
+// generated in advance can be used.
+func (s *Server) SetDPoPNonceRequired(required bool) {
+	s.dpopNonceRequired = required
+}
+
+// SetDPoPBoundAccessTokens specifies whether a client must always use DPoP,
+// so that all its access tokens are bound to a DPoP key.
+func (c *Client) SetDPoPBoundAccessTokens(bound bool) {
+	c.dpopBoundAccessTokens = bound
+}
+
+// tokenHash returns the base64url-encoded SHA-256 hash of an access token, used in the "ath" claim.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newDPoPNonce issues a nonce to be used in the next DPoP proofs,
+// and sends it in the "DPoP-Nonce" header of the response.
+func (s *Server) newDPoPNonce(w http.ResponseWriter) {
+	nonce := rand.Text()
+	if err := s.storage.Put(bucketDPoPNonces, nonce, nil, time.Now().Add(dpopNonceLifetime)); err == nil {
+		w.Header().Set(dpopNonceHeader, nonce)
+	}
+}
+
+// writeDPoPError sends an error response to a request with a DPoP-bound access token,
+// with the "WWW-Authenticate" header of RFC 9449, section 7.1.
+func writeDPoPError(w http.ResponseWriter, code, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP algs=%q, error=%q, error_description=%q`,
+		dpopAlgNames(), code, description))
+	writeJSONError(w, http.StatusUnauthorized, code, description)
+}
+
+// dpopAlgNames returns the algorithms accepted in DPoP proofs, separated by spaces.
+func dpopAlgNames() string {
+	names := make([]string, len(dpopAlgs))
+	for i, alg := range dpopAlgs {
+		names[i] = string(alg)
+	}
+	return strings.Join(names, " ")
+}
+
+// checkDPoPBinding checks that an access token sent to the userinfo endpoint with a given
+// authorization scheme is used as it was issued: tokens bound to a DPoP key must be sent
+// with the "DPoP" scheme and a proof made with the same key, and other tokens with "Bearer".
+// If they are not, it sends an error response and returns false.
+func (s *Server) checkDPoPBinding(w http.ResponseWriter, r *http.Request, scheme, token string, cnf *Confirmation) bool {
+	var jkt string
+	if cnf != nil {
+		jkt = cnf.JKT
+	}
+	if scheme != tokenTypeDPoP {
+		if jkt != "" {
+			writeDPoPError(w, "invalid_token", "Access token bound to a DPoP key.")
+			return false
+		}
+		return true
+	}
+
+	proofJKT, err := s.checkDPoPProof(r, token)
+	if errors.Is(err, errUseDPoPNonce) {
+		s.newDPoPNonce(w)
+		writeDPoPError(w, "use_dpop_nonce", "Resource server requires nonce in DPoP proof.")
+		return false
+	}
+	if err != nil || proofJKT == "" || proofJKT != jkt {
+		if _DEBUG {
+			log.Printf("%s %s %s: invalid DPoP proof: %v\n", r.RemoteAddr, r.Method, r.URL.Path, err)
+		}
+		writeDPoPError(w, "invalid_dpop_proof", "Invalid DPoP proof.")
+		return false
+	}
+	if s.dpopNonceRequired {
+		s.newDPoPNonce(w)
+	}
+	return true
+}
+
+// checkDPoPProof checks the DPoP proof sent in a request, if any (RFC 9449, section 4.3).
+// If accessToken is not empty, the proof must be bound to it.
+// It returns the JWK SHA-256 thumbprint of the key of the proof,
+// or "" if the request does not have a proof.
+func (s *Server) checkDPoPProof(r *http.Request, accessToken string) (string, error) {
+	proofs := r.Header.Values(dpopHeader)
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	if len(proofs) > 1 {
+		return "", errors.New("more than one DPoP proof")
+	}
+
+	token, err := jwt.ParseSigned(proofs[0], dpopAlgs)
+	if err != nil {
+		return "", err
+	}
+	header := token.Headers[0]
+	if header.ExtraHeaders[jose.HeaderType] != dpopJWTType {
+		return "", fmt.Errorf(`invalid "typ" %q`, header.ExtraHeaders[jose.HeaderType])
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.IsPublic() || !header.JSONWebKey.Valid() {
+		return "", errors.New(`invalid "jwk"`)
+	}
+	var claims dpopClaims
+	if err := token.Claims(header.JSONWebKey.Key, &claims); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	switch {
+	case claims.ID == "" || claims.IssuedAt == nil:
+		return "", errors.New(`missing "jti" or "iat" claim`)
+	case claims.Method != r.Method:
+		return "", fmt.Errorf(`invalid "htm" %q`, claims.Method)
+	case claims.URI != s.issuer+r.URL.Path:
+		return "", fmt.Errorf(`invalid "htu" %q`, claims.URI)
+	case claims.IssuedAt.Time().Before(now.Add(-dpopProofLifetime)) || claims.IssuedAt.Time().After(now.Add(assertionLeeway)):
+		return "", errors.New(`invalid "iat"`)
+	case accessToken != "" && claims.ATH != tokenHash(accessToken):
+		return "", errors.New(`invalid "ath"`)
+	}
+	if claims.Nonce != "" || s.dpopNonceRequired {
+		if _, err := s.storage.Get(bucketDPoPNonces, claims.Nonce); claims.Nonce == "" || err != nil {
+			return "", errUseDPoPNonce
+		}
+	}
+
+	thumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	// Every proof can only be used once; its "jti" is remembered until it expires.
+	expires := claims.IssuedAt.Time().Add(dpopProofLifetime)
+	err = s.storage.Create(bucketDPoPProofs, jkt+" "+claims.ID, nil, expires)
+	if errors.Is(err, ErrAlreadyExists) {
+		return "", fmt.Errorf(`replayed DPoP proof ("jti" %q)`, claims.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return jkt, nil
+}
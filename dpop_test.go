@@ -0,0 +1,246 @@
+package jambo_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// dpopProof returns a DPoP proof made with key for a request to ts,
+// with the claims in extra replacing the default ones (or removing them, if nil).
+func dpopProof(t *testing.T, key jose.JSONWebKey, method string, ts *httptest.Server, path string, extra map[string]any) string {
+	t.Helper()
+	claims := map[string]any{
+		"jti": rand.Text(),
+		"htm": method,
+		"htu": ts.URL + "/oidc" + path,
+		"iat": time.Now().Unix(),
+	}
+	for name, value := range extra {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	opts := (&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt")
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key.Key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// jkt returns the JWK SHA-256 thumbprint of a key, as in the "jkt" confirmation.
+func jkt(t *testing.T, key jose.JSONWebKey) string {
+	t.Helper()
+	public := key.Public()
+	thumbprint, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
+// ath returns the hash of an access token, as in the "ath" claim.
+func ath(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// dpopTokens sends a request to the token endpoint authenticated as the test client,
+// with a DPoP proof if it is not empty.  It returns the response and its decoded body.
+func dpopTokens(t *testing.T, ts *httptest.Server, params url.Values, proof string) (*http.Response, map[string]any) {
+	t.Helper()
+	params.Set("client_id", testClientID)
+	params.Set("client_secret", testClientSecret)
+	req, _ := http.NewRequest("POST", ts.URL+"/oidc/token", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if proof != "" {
+		req.Header.Set("DPoP", proof)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	return resp, body
+}
+
+// codeParams returns the parameters of a token request with a new authorization code.
+func codeParams(t *testing.T, ts *httptest.Server, scope string) url.Values {
+	t.Helper()
+	return url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {authCode(t, newBrowser(ts), ts, authParams(url.Values{"scope": {scope}}))},
+		"redirect_uri": {testRedirectURI},
+	}
+}
+
+// dpopUserInfo calls the userinfo endpoint with an access token, using the given
+// authorization scheme and DPoP proof.  It returns the response and its decoded body.
+func dpopUserInfo(t *testing.T, ts *httptest.Server, scheme, accessToken, proof string) (*http.Response, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", ts.URL+"/oidc/userinfo", nil)
+	req.Header.Set("Authorization", scheme+" "+accessToken)
+	if proof != "" {
+		req.Header.Set("DPoP", proof)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	return resp, body
+}
+
+func TestDPoPTokenRequest(t *testing.T) {
+	_, ts := newTestServer(t)
+	key, _ := newClientKey(t, "dpop")
+
+	replayed := dpopProof(t, key, "POST", ts, "/token", nil)
+	tests := []struct {
+		name  string
+		proof string
+	}{
+		{"wrong htm", dpopProof(t, key, "GET", ts, "/token", nil)},
+		{"wrong htu", dpopProof(t, key, "POST", ts, "/userinfo", nil)},
+		{"stale iat", dpopProof(t, key, "POST", ts, "/token", map[string]any{"iat": time.Now().Add(-10 * time.Minute).Unix()})},
+		{"future iat", dpopProof(t, key, "POST", ts, "/token", map[string]any{"iat": time.Now().Add(10 * time.Minute).Unix()})},
+		{"no jti", dpopProof(t, key, "POST", ts, "/token", map[string]any{"jti": nil})},
+		{"not a JWT", "proof"},
+		{"valid", replayed},
+		{"replayed jti", replayed},
+	}
+	for _, test := range tests {
+		resp, body := dpopTokens(t, ts, codeParams(t, ts, "openid"), test.proof)
+		if test.name == "valid" {
+			if resp.StatusCode != http.StatusOK || body["token_type"] != "DPoP" {
+				t.Fatalf("%s: status %d: %v; want a DPoP token", test.name, resp.StatusCode, body)
+			}
+			cnf, _ := jwtClaims(t, body["access_token"].(string))["cnf"].(map[string]any)
+			if cnf["jkt"] != jkt(t, key) {
+				t.Errorf("access token has cnf %v; want jkt %s", cnf, jkt(t, key))
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_dpop_proof" {
+			t.Errorf("%s: status %d: %v; want %d, invalid_dpop_proof", test.name, resp.StatusCode, body, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestDPoPUserInfo(t *testing.T) {
+	_, ts := newTestServer(t)
+	key, _ := newClientKey(t, "dpop")
+	otherKey, _ := newClientKey(t, "other")
+
+	_, tokens := dpopTokens(t, ts, codeParams(t, ts, "openid"), dpopProof(t, key, "POST", ts, "/token", nil))
+	accessToken := tokens["access_token"].(string)
+	proof := func(key jose.JSONWebKey) string {
+		return dpopProof(t, key, "GET", ts, "/userinfo", map[string]any{"ath": ath(accessToken)})
+	}
+
+	replayed := proof(key)
+	if _, body := dpopUserInfo(t, ts, "DPoP", accessToken, replayed); body["sub"] != "alice" {
+		t.Fatalf("userinfo with a valid proof: %v; want sub alice", body)
+	}
+
+	tests := []struct {
+		name      string
+		scheme    string
+		proof     string
+		wantError string
+	}{
+		{"bearer scheme", "Bearer", "", "invalid_token"},
+		{"no proof", "DPoP", "", "invalid_dpop_proof"},
+		{"bad ath", "DPoP", dpopProof(t, key, "GET", ts, "/userinfo", map[string]any{"ath": ath("other")}), "invalid_dpop_proof"},
+		{"no ath", "DPoP", dpopProof(t, key, "GET", ts, "/userinfo", nil), "invalid_dpop_proof"},
+		{"key not in cnf", "DPoP", proof(otherKey), "invalid_dpop_proof"},
+		{"replayed jti", "DPoP", replayed, "invalid_dpop_proof"},
+	}
+	for _, test := range tests {
+		resp, body := dpopUserInfo(t, ts, test.scheme, accessToken, test.proof)
+		if resp.StatusCode != http.StatusUnauthorized || body["error"] != test.wantError {
+			t.Errorf("%s: status %d: %v; want %d, %s", test.name, resp.StatusCode, body, http.StatusUnauthorized, test.wantError)
+		}
+		if header := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(header, "DPoP ") || !strings.Contains(header, `error="`+test.wantError+`"`) {
+			t.Errorf("%s: WWW-Authenticate %q; want a DPoP challenge with error %s", test.name, header, test.wantError)
+		}
+	}
+}
+
+func TestDPoPNonce(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetDPoPNonceRequired(true)
+	key, _ := newClientKey(t, "dpop")
+
+	params := codeParams(t, ts, "openid")
+	resp, body := dpopTokens(t, ts, params, dpopProof(t, key, "POST", ts, "/token", nil))
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "use_dpop_nonce" || nonce == "" {
+		t.Fatalf("token request without nonce: status %d, DPoP-Nonce %q: %v; want use_dpop_nonce", resp.StatusCode, nonce, body)
+	}
+	if _, body := dpopTokens(t, ts, codeParams(t, ts, "openid"), dpopProof(t, key, "POST", ts, "/token", map[string]any{"nonce": "made-up"})); body["error"] != "use_dpop_nonce" {
+		t.Errorf("token request with an unknown nonce: %v; want use_dpop_nonce", body)
+	}
+	resp, tokens := dpopTokens(t, ts, params, dpopProof(t, key, "POST", ts, "/token", map[string]any{"nonce": nonce}))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("token request with nonce: status %d: %v", resp.StatusCode, tokens)
+	}
+	nonce = resp.Header.Get("DPoP-Nonce")
+	accessToken := tokens["access_token"].(string)
+
+	resp, body = dpopUserInfo(t, ts, "DPoP", accessToken, dpopProof(t, key, "GET", ts, "/userinfo", map[string]any{"ath": ath(accessToken)}))
+	if resp.StatusCode != http.StatusUnauthorized || body["error"] != "use_dpop_nonce" || resp.Header.Get("DPoP-Nonce") == "" ||
+		!strings.Contains(resp.Header.Get("WWW-Authenticate"), `error="use_dpop_nonce"`) {
+		t.Errorf("userinfo without nonce: status %d, headers %v: %v; want use_dpop_nonce", resp.StatusCode, resp.Header, body)
+	}
+	_, body = dpopUserInfo(t, ts, "DPoP", accessToken, dpopProof(t, key, "GET", ts, "/userinfo", map[string]any{"ath": ath(accessToken), "nonce": nonce}))
+	if body["sub"] != "alice" {
+		t.Errorf("userinfo with nonce: %v; want sub alice", body)
+	}
+}
+
+func TestDPoPRefreshToken(t *testing.T) {
+	_, ts := newTestServer(t)
+	key, _ := newClientKey(t, "dpop")
+	otherKey, _ := newClientKey(t, "other")
+
+	_, tokens := dpopTokens(t, ts, codeParams(t, ts, "openid offline_access"), dpopProof(t, key, "POST", ts, "/token", nil))
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if refreshToken == "" {
+		t.Fatalf("no refresh token: %v", tokens)
+	}
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+
+	for name, proof := range map[string]string{
+		"no proof":         "",
+		"another DPoP key": dpopProof(t, otherKey, "POST", ts, "/token", nil),
+	} {
+		if resp, body := dpopTokens(t, ts, refresh, proof); resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+			t.Errorf("refresh with %s: status %d: %v; want invalid_grant", name, resp.StatusCode, body)
+		}
+	}
+	resp, body := dpopTokens(t, ts, refresh, dpopProof(t, key, "POST", ts, "/token", nil))
+	if resp.StatusCode != http.StatusOK || body["token_type"] != "DPoP" {
+		t.Errorf("refresh with the same DPoP key: status %d: %v; want a DPoP token", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,214 @@
+// Package filestore provides a [jambo.ClientStore] which keeps the clients
+// in a JSON or YAML file, reloading it whenever it changes.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespedes/jambo"
+	"gopkg.in/yaml.v3"
+)
+
+// ClientStore is a [jambo.ClientStore] backed by a file with a list of clients.
+// Files with the extension ".yaml" or ".yml" are read and written as YAML;
+// any other file is read and written as JSON.
+//
+// Every client is an object with the same fields used in Dynamic Client Registration,
+// such as "client_id", "client_secret" or "redirect_uris".
+type ClientStore struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	clients []*jambo.Client
+}
+
+// NewClientStore returns a ClientStore which reads and writes the clients in a file.
+// If the file does not exist, it is created when the first client is added.
+func NewClientStore(path string) (*ClientStore, error) {
+	cs := &ClientStore{path: path}
+	if err := cs.reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (cs *ClientStore) isYAML() bool {
+	ext := strings.ToLower(filepath.Ext(cs.path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// reload reads the file again if it has been modified since the last time.
+// It must be called with cs.mu locked (or before the store is in use).
+func (cs *ClientStore) reload() error {
+	fi, err := os.Stat(cs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		cs.clients = nil
+		cs.modTime = time.Time{}
+		cs.size = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(cs.modTime) && fi.Size() == cs.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(cs.path)
+	if err != nil {
+		return err
+	}
+	if cs.isYAML() {
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("%s: %w", cs.path, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("%s: %w", cs.path, err)
+		}
+	}
+	var clients []*jambo.Client
+	if len(strings.TrimSpace(string(data))) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, &clients); err != nil {
+			return fmt.Errorf("%s: %w", cs.path, err)
+		}
+	}
+
+	cs.clients = clients
+	cs.modTime = fi.ModTime()
+	cs.size = fi.Size()
+	return nil
+}
+
+// save writes the list of clients to the file, replacing it atomically.
+// It must be called with cs.mu locked.
+func (cs *ClientStore) save() error {
+	data, err := json.MarshalIndent(cs.clients, "", "  ")
+	if err != nil {
+		return err
+	}
+	if cs.isYAML() {
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		if data, err = yaml.Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cs.path), "."+filepath.Base(cs.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), cs.path); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(cs.path)
+	if err != nil {
+		return err
+	}
+	cs.modTime = fi.ModTime()
+	cs.size = fi.Size()
+	return nil
+}
+
+func (cs *ClientStore) index(id string) int {
+	for i, c := range cs.clients {
+		if c.ID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Client returns the client with a given ID.
+func (cs *ClientStore) Client(id string) (*jambo.Client, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.reload(); err != nil {
+		return nil, err
+	}
+	i := cs.index(id)
+	if i < 0 {
+		return nil, jambo.ErrClientNotFound
+	}
+	return cs.clients[i], nil
+}
+
+// Clients returns all the clients in the file.
+func (cs *ClientStore) Clients() ([]*jambo.Client, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.reload(); err != nil {
+		return nil, err
+	}
+	return append([]*jambo.Client(nil), cs.clients...), nil
+}
+
+// CreateClient adds a new client to the file.
+func (cs *ClientStore) CreateClient(c *jambo.Client) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.reload(); err != nil {
+		return err
+	}
+	if cs.index(c.ID()) >= 0 {
+		return fmt.Errorf("client %q already exists", c.ID())
+	}
+	cs.clients = append(cs.clients, c)
+	return cs.save()
+}
+
+// UpdateClient replaces a client in the file.
+func (cs *ClientStore) UpdateClient(c *jambo.Client) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.reload(); err != nil {
+		return err
+	}
+	i := cs.index(c.ID())
+	if i < 0 {
+		return jambo.ErrClientNotFound
+	}
+	cs.clients[i] = c
+	return cs.save()
+}
+
+// DeleteClient removes a client from the file.
+func (cs *ClientStore) DeleteClient(id string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.reload(); err != nil {
+		return err
+	}
+	i := cs.index(id)
+	if i < 0 {
+		return jambo.ErrClientNotFound
+	}
+	cs.clients = append(cs.clients[:i], cs.clients[i+1:]...)
+	return cs.save()
+}
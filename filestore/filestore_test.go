@@ -0,0 +1,77 @@
+package filestore_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cespedes/jambo"
+	"github.com/cespedes/jambo/filestore"
+	"github.com/cespedes/jambo/storagetest"
+)
+
+func TestClientStore(t *testing.T) {
+	for _, name := range []string{"clients.json", "clients.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			cs, err := filestore.NewClientStore(filepath.Join(t.TempDir(), name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := storagetest.TestClientStore(cs); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSaveClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.json")
+
+	// stored returns the client kept in the file, as JSON.
+	stored := func() string {
+		t.Helper()
+		cs, err := filestore.NewClientStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients, err := cs.Clients()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clients) != 1 {
+			t.Fatalf("%d clients in the file; want 1", len(clients))
+		}
+		data, _ := json.Marshal(clients[0])
+		return string(data)
+	}
+
+	var saved string
+	for restart := range 2 {
+		cs, err := filestore.NewClientStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := jambo.NewServer("https://jambo.example/oidc", "/oidc")
+		s.SetClientStore(cs)
+		c := s.NewClient("client", "secret")
+		if restart > 0 && stored() != saved {
+			t.Errorf("restart %d: NewClient replaced the stored client before SaveClient: %s", restart, stored())
+		}
+		c.AddAllowedRedirectURIs("https://client.example/cb")
+		c.SetRequireConsent(true)
+		if err := s.SaveClient(c); err != nil {
+			t.Fatalf("restart %d: SaveClient: %v", restart, err)
+		}
+
+		saved = stored()
+		var metadata struct {
+			RedirectURIs   []string `json:"redirect_uris"`
+			RequireConsent bool     `json:"require_consent"`
+		}
+		json.Unmarshal([]byte(saved), &metadata)
+		if !slices.Equal(metadata.RedirectURIs, []string{"https://client.example/cb"}) || !metadata.RequireConsent {
+			t.Errorf("restart %d: reloaded client is %s", restart, saved)
+		}
+	}
+}
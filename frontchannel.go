@@ -0,0 +1,34 @@
+package jambo
+
+import (
+	"net/url"
+)
+
+// SetFrontchannelLogoutURI sets the URI that will be loaded by the browser
+// (in a hidden iframe) when a session in which the client has received tokens ends.
+func (c *Client) SetFrontchannelLogoutURI(uri string) {
+	c.frontchannelLogoutURI = uri
+}
+
+// frontchannelLogoutURIs returns the logout URIs, with the "iss" and "sid" parameters,
+// of all the clients that have received tokens in a browser session.
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html
+func (s *Server) frontchannelLogoutURIs(sess *ssoSession) []string {
+	var uris []string
+	for _, id := range sess.Clients {
+		client := s.findClient(id)
+		if client == nil || client.frontchannelLogoutURI == "" {
+			continue
+		}
+		u, err := url.Parse(client.frontchannelLogoutURI)
+		if err != nil {
+			continue
+		}
+		q := u.Query()
+		q.Set("iss", s.issuer)
+		q.Set("sid", sess.SID)
+		u.RawQuery = q.Encode()
+		uris = append(uris, u.String())
+	}
+	return uris
+}
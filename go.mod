@@ -2,6 +2,13 @@ module github.com/cespedes/jambo
 
 go 1.24.3
 
-require github.com/go-jose/go-jose/v4 v4.1.0
+require (
+	github.com/go-jose/go-jose/v4 v4.1.0
+	github.com/iancoleman/orderedmap v0.3.0
+	github.com/mattn/go-sqlite3 v1.14.52
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.48.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
-require github.com/iancoleman/orderedmap v0.3.0 // indirect
+require golang.org/x/sys v0.41.0 // indirect
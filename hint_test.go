@@ -0,0 +1,81 @@
+package jambo_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cespedes/jambo"
+)
+
+func TestLoginHint(t *testing.T) {
+	s, ts := newTestServer(t)
+	var hints []string
+	s.SetAuthenticator(func(req *jambo.Request) jambo.Response {
+		hints = append(hints, req.LoginHint)
+		return jambo.Response{Type: jambo.ResponseTypeLoginOK, Login: req.Params["login"]}
+	})
+
+	hint := `bob"><script>alert(1)</script>`
+	resp, err := newBrowser(ts).Get(ts.URL + "/oidc/auth?" + authParams(url.Values{"login_hint": {hint}}).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readBody(t, resp)
+	if !strings.Contains(page, `value="bob&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`) || strings.Contains(page, "<script>alert(1)") {
+		t.Errorf("login page does not have the escaped login_hint:\n%s", page)
+	}
+
+	login(t, newBrowser(ts), ts, authParams(url.Values{"login_hint": {"bob"}}), "bob").Body.Close()
+	if len(hints) != 1 || hints[0] != "bob" {
+		t.Errorf("authenticator got login hints %q; want bob", hints)
+	}
+}
+
+func TestIDTokenHint(t *testing.T) {
+	_, ts := newTestServer(t)
+	_, otherTS := newTestServer(t)
+
+	alice := newBrowser(ts)
+	idToken := getTokens(t, ts, authParams(nil))["id_token"].(string)
+	authCode(t, alice, ts, authParams(nil))
+	bob := newBrowser(ts)
+	login(t, bob, ts, authParams(nil), "bob").Body.Close()
+
+	// The session is used only if it is the user in the hint.
+	hinted := authParams(url.Values{"id_token_hint": {idToken}, "prompt": {"none"}})
+	if location := authRedirect(t, alice, ts, hinted); location == nil || location.Query().Get("code") == "" {
+		t.Errorf("id_token_hint of the user of the session: redirected to %v; want a code", location)
+	}
+	if location := authRedirect(t, bob, ts, hinted); location == nil || location.Query().Get("error") != "login_required" {
+		t.Errorf("id_token_hint of another user, with prompt=none: redirected to %v; want login_required", location)
+	}
+
+	// Otherwise, the login form is shown for the user in the hint, and nobody else can log in.
+	hinted.Del("prompt")
+	resp, err := bob.Get(ts.URL + "/oidc/auth?" + hinted.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page := readBody(t, resp); !strings.Contains(page, `value="alice"`) {
+		t.Errorf("login page for id_token_hint of another user does not ask for alice:\n%s", page)
+	}
+	resp = login(t, bob, ts, hinted, "bob")
+	resp.Body.Close()
+	if location, _ := url.Parse(resp.Header.Get("Location")); location.Query().Get("error") != "login_required" {
+		t.Errorf("login as bob with id_token_hint of alice: redirected to %s; want login_required", location)
+	}
+
+	// ID tokens issued by other servers, and other JWTs, are rejected.
+	location, _ := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_mode": {"jwt"}}))
+	for name, hint := range map[string]string{
+		"not a JWT":           "hint",
+		"from another server": getTokens(t, otherTS, authParams(nil))["id_token"].(string),
+		"JARM response":       location.Query().Get("response"),
+	} {
+		location := authRedirect(t, alice, ts, authParams(url.Values{"id_token_hint": {hint}}))
+		if location == nil || location.Query().Get("error") != "invalid_request" {
+			t.Errorf("id_token_hint %s: redirected to %v; want invalid_request", name, location)
+		}
+	}
+}
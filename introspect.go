@@ -0,0 +1,82 @@
+package jambo
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// An introspectionResponse is the response of the introspection endpoint (RFC 7662, section 2.2).
+type introspectionResponse struct {
+	Active     bool         `json:"active"`
+	Scope      string       `json:"scope,omitempty"`
+	ClientID   string       `json:"client_id,omitempty"`
+	Username   string       `json:"username,omitempty"`
+	TokenType  string       `json:"token_type,omitempty"`
+	Expiration int64        `json:"exp,omitempty"`
+	IssuedAt   int64        `json:"iat,omitempty"`
+	Subject    string       `json:"sub,omitempty"`
+	Audience   jwt.Audience `json:"aud,omitempty"`
+	Issuer     string       `json:"iss,omitempty"`
+	ID         string       `json:"jti,omitempty"`
+
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+// openIDIntrospect is the handler for the token introspection endpoint ("/introspect"),
+// defined in RFC 7662.  Any client can introspect the access tokens (so resource servers
+// can be registered as clients), but only the client a refresh token was issued to
+// can introspect it.
+func (s *Server) openIDIntrospect(w http.ResponseWriter, r *http.Request) {
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "Required param: token.")
+		return
+	}
+
+	// The "token_type_hint" parameter is only an optimization, so it is ignored.
+	if conn := s.loadRefreshToken(token); conn != nil && conn.client.id == client.id {
+		writeJSON(w, http.StatusOK, introspectionResponse{
+			Active:    true,
+			Scope:     strings.Join(conn.scopes, " "),
+			ClientID:  conn.client.id,
+			Username:  conn.response.Login,
+			TokenType: "refresh_token",
+			Subject:   conn.response.Login,
+			Issuer:    s.issuer,
+		})
+		return
+	}
+
+	accessToken, err := s.parseAccessToken(token)
+	if err != nil || accessToken.Expiration < time.Now().Unix() || s.accessTokenRevoked(accessToken) {
+		writeJSON(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+	tokenType := "Bearer"
+	if accessToken.Confirmation != nil && accessToken.Confirmation.JKT != "" {
+		tokenType = tokenTypeDPoP
+	}
+	writeJSON(w, http.StatusOK, introspectionResponse{
+		Active:     true,
+		Scope:      accessToken.Scope,
+		ClientID:   accessToken.ClientID,
+		Username:   accessToken.Subject,
+		TokenType:  tokenType,
+		Expiration: accessToken.Expiration,
+		IssuedAt:   accessToken.IssuedAt,
+		Subject:    accessToken.Subject,
+		Audience:   accessToken.Audience,
+		Issuer:     accessToken.Issuer,
+		ID:         accessToken.ID,
+
+		Confirmation: accessToken.Confirmation,
+	})
+}
@@ -0,0 +1,189 @@
+package jambo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// Algorithms accepted in request objects (RFC 9101):
+var (
+	requestObjectSigningAlgs = assertionKeyAlgs
+	requestObjectKeyAlgs     = []jose.KeyAlgorithm{jose.RSA_OAEP, jose.RSA_OAEP_256}
+	requestObjectContentEncs = []jose.ContentEncryption{
+		jose.A128CBC_HS256, jose.A192CBC_HS384, jose.A256CBC_HS512,
+		jose.A128GCM, jose.A192GCM, jose.A256GCM,
+	}
+)
+
+// requestObjectMaxSize is the maximum size of a request object fetched from a "request_uri".
+const requestObjectMaxSize = 64 << 10
+
+// JWT claims of a request object which are not authorization request parameters:
+var requestObjectJWTClaims = []string{"iss", "aud", "exp", "nbf", "iat", "jti"}
+
+// AddRequestURIs adds one or more URLs from where the server can fetch the request
+// objects of a client, sent in the "request_uri" parameter.  A fragment is ignored
+// when comparing them.  Other URLs are not fetched.
+func (c *Client) AddRequestURIs(uris ...string) {
+	c.requestURIs = append(c.requestURIs, uris...)
+}
+
+// SetRequireSignedRequestObject specifies whether a client must send its authorization
+// requests in a signed request object.  If it does, only the parameters in the request
+// object are used.
+func (c *Client) SetRequireSignedRequestObject(require bool) {
+	c.requireSignedRequestObject = require
+}
+
+// requestObjectParams returns the parameters of an authorization request
+// with a request object ("request" or "request_uri" parameters, RFC 9101).
+// Following OpenID Connect Core, section 6.3.3, the parameters in the request
+// object supersede those sent outside of it, unless the client requires signed
+// request objects; then, only those in the request object are used.
+func (s *Server) requestObjectParams(params url.Values) (url.Values, error) {
+	client := s.findClient(params.Get("client_id"))
+	if client == nil {
+		return nil, fmt.Errorf("unknown client %q", params.Get("client_id"))
+	}
+	request, requestURI := params.Get("request"), params.Get("request_uri")
+	switch {
+	case request == "" && requestURI == "":
+		if client.requireSignedRequestObject {
+			return nil, errors.New("this client must use signed request objects")
+		}
+		return params, nil
+	case request != "" && requestURI != "":
+		return nil, errors.New("request and request_uri cannot be used together")
+	case requestURI != "":
+		var err error
+		if request, err = s.fetchRequestObject(client, requestURI); err != nil {
+			return nil, err
+		}
+	}
+
+	claims, err := s.parseRequestObject(client, request)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request object: %w", err)
+	}
+	if id, ok := claims["client_id"]; ok && id != client.id {
+		return nil, errors.New("client_id does not match the request object")
+	}
+
+	merged := url.Values{}
+	if !client.requireSignedRequestObject {
+		maps.Copy(merged, params)
+	}
+	merged.Del("request")
+	merged.Del("request_uri")
+	for key, value := range claims {
+		if slices.Contains(requestObjectJWTClaims, key) {
+			continue
+		}
+		if str, ok := value.(string); ok {
+			merged.Set(key, str)
+			continue
+		}
+		// Several resources (RFC 8707) are sent as an array of strings.
+		if values, ok := value.([]any); ok && key == "resource" {
+			merged.Del(key)
+			for _, v := range values {
+				str, ok := v.(string)
+				if !ok {
+					return nil, errors.New(`invalid "resource" in the request object`)
+				}
+				merged.Add(key, str)
+			}
+			continue
+		}
+		// Other values (such as "max_age" or "claims") are sent as JSON.
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		merged.Set(key, string(data))
+	}
+	merged.Set("client_id", client.id)
+	return merged, nil
+}
+
+// fetchRequestObject gets a request object from one of the "request_uris" of a client.
+func (s *Server) fetchRequestObject(c *Client, requestURI string) (string, error) {
+	base, _, _ := strings.Cut(requestURI, "#")
+	if !slices.ContainsFunc(c.requestURIs, func(uri string) bool {
+		registered, _, _ := strings.Cut(uri, "#")
+		return registered == base
+	}) {
+		return "", fmt.Errorf("unregistered request_uri %q", requestURI)
+	}
+
+	resp, err := s.httpClient.Get(requestURI)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request_uri %s: %s", requestURI, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, requestObjectMaxSize))
+	if err != nil {
+		return "", fmt.Errorf("request_uri %s: %w", requestURI, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parseRequestObject checks the signature of a request object with the keys of a client,
+// decrypting it first with the encryption key of the server if needed.  It returns its claims.
+func (s *Server) parseRequestObject(c *Client, request string) (map[string]any, error) {
+	// Encrypted request objects have five parts (RFC 7516, section 7.1).
+	if strings.Count(request, ".") == 4 {
+		encrypted, err := jose.ParseEncrypted(request, requestObjectKeyAlgs, requestObjectContentEncs)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := encrypted.Decrypt(s.encKey.Key)
+		if err != nil {
+			return nil, err
+		}
+		request = string(payload)
+	}
+
+	token, err := jwt.ParseSigned(request, requestObjectSigningAlgs)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.clientKeys(c, token.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		registered jwt.Claims
+		claims     map[string]any
+	)
+	if !slices.ContainsFunc(keys, func(key jose.JSONWebKey) bool {
+		return token.Claims(key, &registered, &claims) == nil
+	}) {
+		return nil, errors.New("invalid signature")
+	}
+
+	if err := registered.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, assertionLeeway); err != nil {
+		return nil, err
+	}
+	if registered.Issuer != "" && registered.Issuer != c.id {
+		return nil, fmt.Errorf(`invalid "iss" %q`, registered.Issuer)
+	}
+	if len(registered.Audience) > 0 && !registered.Audience.Contains(s.issuer) {
+		return nil, errors.New(`invalid "aud"`)
+	}
+	return claims, nil
+}
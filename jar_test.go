@@ -0,0 +1,201 @@
+package jambo_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// newJARTestServer returns a test server whose client has the public key of key.
+func newJARTestServer(t *testing.T) (*jambo.Server, *httptest.Server, *jambo.Client, jose.JSONWebKey) {
+	t.Helper()
+	key, jwks := newClientKey(t, "jar-key")
+	var c *jambo.Client
+	s, ts := newTestServer(t, func(tc *jambo.Client) {
+		c = tc
+		c.SetJWKS(jwks)
+	})
+	return s, ts, c, key
+}
+
+// requestObject returns the claims of a request object from the test client
+// to ts, with the parameters of authParams and those in extra.
+func requestObject(ts *httptest.Server, extra map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss": testClientID,
+		"aud": ts.URL + "/oidc",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for key, values := range authParams(nil) {
+		claims[key] = values[0]
+	}
+	for key, value := range extra {
+		claims[key] = value
+	}
+	return claims
+}
+
+// encryptJWT encrypts a JWT with the encryption key published by ts.
+func encryptJWT(t *testing.T, ts *httptest.Server, token string) string {
+	t.Helper()
+	for _, key := range serverKeys(t, ts).Keys {
+		if key.Use != "enc" {
+			continue
+		}
+		encrypter, err := jose.NewEncrypter(jose.A256GCM,
+			jose.Recipient{Algorithm: jose.KeyAlgorithm(key.Algorithm), Key: key.Key, KeyID: key.KeyID},
+			(&jose.EncrypterOptions{}).WithContentType("JWT"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := encrypter.Encrypt([]byte(token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		serialized, err := encrypted.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return serialized
+	}
+	t.Fatal("no encryption key")
+	return ""
+}
+
+// unsignedJWT returns a JWT with "alg":"none".
+func unsignedJWT(claims any) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload, _ := json.Marshal(claims)
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestRequestObject(t *testing.T) {
+	_, ts, _, key := newJARTestServer(t)
+	otherKey, _ := newClientKey(t, "jar-key")
+
+	signed := signJWT(t, key, "oauth-authz-req+jwt", requestObject(ts, map[string]any{"state": "inside"}))
+	tests := []struct {
+		name      string
+		request   string
+		wantState string // state in the response, or "" if the request must be rejected
+		wantError string
+	}{
+		{"signed", signed, "inside", ""},
+		{"encrypted", encryptJWT(t, ts, signed), "inside", ""},
+		{"unsigned", unsignedJWT(requestObject(ts, nil)), "", "invalid request object"},
+		{"signed with another key", signJWT(t, otherKey, "", requestObject(ts, nil)), "", "invalid signature"},
+		{"expired", signJWT(t, key, "", requestObject(ts, map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), "", "invalid request object"},
+		{"wrong aud", signJWT(t, key, "", requestObject(ts, map[string]any{"aud": "https://other.example"})), "", `invalid "aud"`},
+		{"wrong iss", signJWT(t, key, "", requestObject(ts, map[string]any{"iss": "other"})), "", `invalid "iss"`},
+		{"client_id mismatch", signJWT(t, key, "", requestObject(ts, map[string]any{"client_id": "other"})), "", "client_id does not match"},
+	}
+	for _, test := range tests {
+		params := url.Values{
+			"client_id": {testClientID},
+			"request":   {test.request},
+			"state":     {"outside"},
+		}
+		location, page := authorize(t, newBrowser(ts), ts, params)
+		if test.wantError != "" {
+			if location != nil || !strings.Contains(html.UnescapeString(page), test.wantError) {
+				t.Errorf("%s: redirected to %v, page %q; want an error page with %q", test.name, location, page, test.wantError)
+			}
+			continue
+		}
+		if location == nil {
+			t.Errorf("%s: not redirected to the client:\n%s", test.name, page)
+			continue
+		}
+		if got := location.Query().Get("state"); got != test.wantState || location.Query().Get("code") == "" {
+			t.Errorf("%s: redirected to %s; want a code and state %q", test.name, location, test.wantState)
+		}
+	}
+}
+
+func TestRequireSignedRequestObject(t *testing.T) {
+	_, ts, c, key := newJARTestServer(t)
+	c.SetRequireSignedRequestObject(true)
+
+	// Without a request object, the request is rejected.
+	if location, page := authorize(t, newBrowser(ts), ts, authParams(nil)); location != nil || !strings.Contains(page, "must use signed request objects") {
+		t.Errorf("request without request object: redirected to %v, page %q; want an error", location, page)
+	}
+
+	// With it, the parameters outside of it are ignored.
+	claims := requestObject(ts, nil)
+	delete(claims, "state")
+	params := url.Values{
+		"client_id": {testClientID},
+		"request":   {signJWT(t, key, "", claims)},
+		"state":     {"outside"},
+	}
+	location, page := authorize(t, newBrowser(ts), ts, params)
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	if location.Query().Has("state") {
+		t.Errorf("redirected to %s; want no state", location)
+	}
+}
+
+func TestRequestURI(t *testing.T) {
+	_, ts, c, key := newJARTestServer(t)
+	object := signJWT(t, key, "", requestObject(ts, map[string]any{"state": "fetched"}))
+	requests := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/oauth-authz-req+jwt")
+		w.Write([]byte(object))
+	}))
+	defer requests.Close()
+	c.AddRequestURIs(requests.URL + "/registered")
+
+	params := url.Values{"client_id": {testClientID}, "request_uri": {requests.URL + "/registered#hash"}}
+	location, page := authorize(t, newBrowser(ts), ts, params)
+	if location == nil || location.Query().Get("state") != "fetched" {
+		t.Errorf("registered request_uri: redirected to %v; want state fetched:\n%s", location, page)
+	}
+
+	params.Set("request_uri", requests.URL+"/unregistered")
+	location, page = authorize(t, newBrowser(ts), ts, params)
+	if location != nil || !strings.Contains(page, "unregistered request_uri") {
+		t.Errorf("unregistered request_uri: redirected to %v, page %q; want an error", location, page)
+	}
+}
+
+func TestRequestObjectResources(t *testing.T) {
+	s, ts, c, key := newJARTestServer(t)
+	apis := []string{"https://api1.example/", "https://api2.example/"}
+	for _, api := range apis {
+		s.AddAPIResource(jambo.APIResource{Identifier: api, Scopes: []string{"read"}})
+		c.GrantAPIResource(api, "read")
+	}
+
+	params := url.Values{
+		"client_id": {testClientID},
+		"request":   {signJWT(t, key, "", requestObject(ts, map[string]any{"scope": "openid read", "resource": apis}))},
+	}
+	location, page := authorize(t, newBrowser(ts), ts, params)
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	status, tokens := postForm(t, ts, "/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {location.Query().Get("code")},
+		"redirect_uri": {testRedirectURI},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token endpoint: status %d: %v", status, tokens)
+	}
+	aud, _ := jwtClaims(t, tokens["access_token"].(string))["aud"].([]any)
+	if len(aud) != 2 || aud[0] != apis[0] || aud[1] != apis[1] {
+		t.Errorf("access token has aud %v; want %v", aud, apis)
+	}
+}
@@ -0,0 +1,62 @@
+package jambo
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// Values for the "response_mode" parameter with JWT Secured Authorization Responses
+// (JARM, https://openid.net/specs/oauth-v2-jarm.html):
+const (
+	responseModeJWT         = "jwt" // "query.jwt" for the code flow, "fragment.jwt" for the others
+	responseModeQueryJWT    = "query.jwt"
+	responseModeFragmentJWT = "fragment.jwt"
+	responseModeFormPostJWT = "form_post.jwt"
+)
+
+// authorizationResponseLifetime is the time a JARM response is valid.
+const authorizationResponseLifetime = 10 * time.Minute
+
+// authorizationSigningAlgs are the algorithms that can be used to sign the
+// authorization responses.  All of them use the RSA key of the server.
+var authorizationSigningAlgs = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+}
+
+// SetAuthorizationSignedResponseAlg sets the algorithm used to sign the JWT Secured
+// Authorization Responses sent to a client.  The default is "RS256".
+func (c *Client) SetAuthorizationSignedResponseAlg(alg string) {
+	c.authorizationResponseAlg = alg
+}
+
+// jwtResponse returns the parameters of an authorization response using a JARM
+// response mode, and the response mode used to send them: the original parameters
+// are sent in a JWT signed by the server, in the "response" parameter.
+func (s *Server) jwtResponse(conn *Connection, params url.Values) (url.Values, string, error) {
+	mode := strings.TrimSuffix(conn.responseMode, ".jwt")
+	if mode == responseModeJWT {
+		mode = defaultResponseMode(conn.responseType)
+	}
+
+	claims := map[string]any{
+		"iss": s.issuer,
+		"aud": conn.client.id,
+		"exp": time.Now().Add(authorizationResponseLifetime).Unix(),
+	}
+	for key := range params {
+		claims[key] = params.Get(key)
+	}
+	alg := jose.RS256
+	if conn.client.authorizationResponseAlg != "" {
+		alg = jose.SignatureAlgorithm(conn.client.authorizationResponseAlg)
+	}
+	response, err := s.signWithAlg(claims, "", alg)
+	if err != nil {
+		return nil, "", err
+	}
+	return url.Values{"response": {response}}, mode, nil
+}
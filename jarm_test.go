@@ -0,0 +1,102 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// jarmClaims checks the signature of a JARM response with the keys of ts and the
+// algorithm alg, and its "iss", "aud" and "exp" claims.  It returns its claims.
+func jarmClaims(t *testing.T, ts *httptest.Server, response string, alg jose.SignatureAlgorithm) map[string]any {
+	t.Helper()
+	jws, err := jose.ParseSigned(response, []jose.SignatureAlgorithm{alg})
+	if err != nil {
+		t.Fatalf("response %q: %v", response, err)
+	}
+	jwks := serverKeys(t, ts)
+	keys := jwks.Key(jws.Signatures[0].Header.KeyID)
+	if len(keys) == 0 {
+		t.Fatalf("response signed with an unknown key %q", jws.Signatures[0].Header.KeyID)
+	}
+	payload, err := jws.Verify(keys[0])
+	if err != nil {
+		t.Fatalf("response: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if claims["iss"] != ts.URL+"/oidc" || claims["aud"] != testClientID {
+		t.Errorf("response has iss %v and aud %v; want %s and %s", claims["iss"], claims["aud"], ts.URL+"/oidc", testClientID)
+	}
+	exp, _ := claims["exp"].(float64)
+	if now := time.Now(); exp < float64(now.Unix()) || exp > float64(now.Add(10*time.Minute).Unix()) {
+		t.Errorf("response has exp %v; want less than 10 minutes from now", claims["exp"])
+	}
+	return claims
+}
+
+func TestJARMResponseModes(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	for _, mode := range []string{"jwt", "query.jwt", "fragment.jwt", "form_post.jwt"} {
+		params := authParams(url.Values{"response_mode": {mode}})
+		var response url.Values
+		switch mode {
+		case "form_post.jwt":
+			_, _, _, response = formPost(t, ts, params)
+		default:
+			location, page := authorize(t, newBrowser(ts), ts, params)
+			if location == nil {
+				t.Fatalf("%s: not redirected to the client:\n%s", mode, page)
+			}
+			response = location.Query()
+			if mode == "fragment.jwt" {
+				response, _ = url.ParseQuery(location.Fragment)
+			}
+		}
+		if len(response) != 1 || response.Get("response") == "" {
+			t.Errorf("%s: response %v; want only the response parameter", mode, response)
+			continue
+		}
+		claims := jarmClaims(t, ts, response.Get("response"), jose.RS256)
+		if claims["code"] == nil || claims["state"] != "state" {
+			t.Errorf("%s: response has claims %v; want a code and the state", mode, claims)
+		}
+	}
+}
+
+func TestJARMSigningAlg(t *testing.T) {
+	_, ts := newTestServer(t, func(c *jambo.Client) { c.SetAuthorizationSignedResponseAlg("PS256") })
+
+	location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_mode": {"jwt"}}))
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	if claims := jarmClaims(t, ts, location.Query().Get("response"), jose.PS256); claims["code"] == nil {
+		t.Errorf("response has claims %v; want a code", claims)
+	}
+}
+
+func TestJARMError(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_mode": {"jwt"}, "prompt": {"none"}}))
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	if location.Query().Has("error") {
+		t.Errorf("redirected to %s; want the error only in the response", location)
+	}
+	claims := jarmClaims(t, ts, location.Query().Get("response"), jose.RS256)
+	if claims["error"] != "login_required" || claims["state"] != "state" || claims["code"] != nil {
+		t.Errorf("response has claims %v; want error login_required and the state", claims)
+	}
+}
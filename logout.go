@@ -0,0 +1,137 @@
+package jambo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+)
+
+// openIDEndSession is the handler for the RP-initiated logout endpoint ("/logout").
+// https://openid.net/specs/openid-connect-rpinitiated-1_0.html
+func (s *Server) openIDEndSession(w http.ResponseWriter, r *http.Request) {
+	var client *Client
+	clientID := r.FormValue("client_id")
+	redirectURI := r.FormValue("post_logout_redirect_uri")
+	state := r.FormValue("state")
+
+	var hint *IDToken
+	if token := r.FormValue("id_token_hint"); token != "" {
+		var err error
+		if hint, err = s.parseIDTokenHint(token); err != nil {
+			s.template(w, r, "error.html", map[string]string{
+				"errorType": "Bad request",
+				"error":     err.Error(),
+			})
+			return
+		}
+		if clientID == "" {
+			clientID = hint.Audience
+		} else if clientID != hint.Audience {
+			s.template(w, r, "error.html", map[string]string{
+				"errorType": "Bad request",
+				"error":     `"client_id" does not match the audience of "id_token_hint"`,
+			})
+			return
+		}
+	}
+
+	if clientID != "" {
+		if client = s.findClient(clientID); client == nil {
+			s.template(w, r, "error.html", map[string]string{
+				"errorType": "Bad request",
+				"error":     fmt.Sprintf(`unknown client "%s"`, clientID),
+			})
+			return
+		}
+	}
+
+	if redirectURI != "" && (client == nil || !slices.Contains(client.allowedPostLogoutRedirectURIs, redirectURI)) {
+		s.template(w, r, "error.html", map[string]string{
+			"errorType": "Bad request",
+			"error":     fmt.Sprintf(`Unregistered post_logout_redirect_uri ("%s")`, redirectURI),
+		})
+		return
+	}
+	// The browser is sent there, so only web addresses are accepted.
+	if u, err := url.Parse(redirectURI); redirectURI != "" && (err != nil || (u.Scheme != "https" && u.Scheme != "http")) {
+		s.template(w, r, "error.html", map[string]string{
+			"errorType": "Bad request",
+			"error":     fmt.Sprintf(`Invalid post_logout_redirect_uri ("%s")`, redirectURI),
+		})
+		return
+	}
+
+	var frontchannelURIs []string
+	if sess := s.getSession(w, r); sess != nil {
+		// The user has to confirm the logout, unless the client has proved
+		// with id_token_hint that it is logged out from this same session.
+		if (hint == nil || hint.SessionID != sess.SID) && r.PostFormValue("confirm") == "" {
+			s.template(w, r, "logout.html", map[string]string{
+				"postURL":               filepath.Join(s.root, "/logout"),
+				"login":                 sess.Response.Login,
+				"clientID":              clientID,
+				"postLogoutRedirectURI": redirectURI,
+				"state":                 state,
+			})
+			return
+		}
+		frontchannelURIs = s.frontchannelLogoutURIs(sess)
+		s.endSession(sess)
+		s.clearSessionCookies(w)
+	}
+
+	if redirectURI != "" && state != "" {
+		u, err := url.Parse(redirectURI)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("post_logout_redirect_uri: %v", err), http.StatusBadRequest)
+			return
+		}
+		q := u.Query()
+		q.Set("state", state)
+		u.RawQuery = q.Encode()
+		redirectURI = u.String()
+	}
+
+	// The front-channel logout URIs are loaded in the logout page,
+	// which redirects to post_logout_redirect_uri when finished.
+	if len(frontchannelURIs) > 0 || redirectURI == "" {
+		s.render(w, r, "loggedout.html", map[string]any{
+			"frontchannelLogoutURIs": frontchannelURIs,
+			"redirect":               redirectURI,
+		})
+		return
+	}
+
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+// endSession terminates a browser session, and notifies all the clients
+// that have received tokens in it.
+func (s *Server) endSession(sess *ssoSession) {
+	s.deleteSession(sess)
+	s.backchannelLogout(sess)
+}
+
+// LogoutUser terminates all the browser sessions of a user (for instance,
+// because it has been disabled), and notifies the clients.
+// The cookies of the sessions are removed the next time the browser
+// connects to the server, or they expire with the idle timeout of the sessions.
+func (s *Server) LogoutUser(login string) error {
+	sessions, err := s.storage.List(bucketSessions)
+	if err != nil {
+		return err
+	}
+	for _, data := range sessions {
+		var sess ssoSession
+		if err := json.Unmarshal(data, &sess); err != nil {
+			continue
+		}
+		if sess.Response.Login == login {
+			s.endSession(&sess)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package jambo_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+func TestLogoutRedirect(t *testing.T) {
+	s, ts := newTestServer(t)
+	c := s.NewClient("frontchannel-client", testClientSecret)
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetFrontchannelLogoutURI("https://client.example/logout")
+	c.AddAllowedPostLogoutRedirectURIs("https://client.example/bye", "javascript:alert(document.domain)")
+
+	logout := func(redirectURI string) string {
+		browser := newBrowser(ts)
+		params := authParams(url.Values{"client_id": {"frontchannel-client"}})
+		code := authCode(t, browser, ts, params)
+		resp, err := ts.Client().PostForm(ts.URL+"/oidc/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"client_id":     {"frontchannel-client"},
+			"client_secret": {testClientSecret},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		readBody(t, resp)
+
+		resp, err = browser.PostForm(ts.URL+"/oidc/logout", url.Values{
+			"client_id":                {"frontchannel-client"},
+			"post_logout_redirect_uri": {redirectURI},
+			"confirm":                  {"true"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("logout: status %s", resp.Status)
+		}
+		return readBody(t, resp)
+	}
+
+	page := logout("https://client.example/bye")
+	if !strings.Contains(page, `<iframe class="frontchannel-logout" src="https://client.example/logout?`) {
+		t.Errorf("logout page does not load the front-channel logout URI:\n%s", page)
+	}
+	if !strings.Contains(page, `<a id="continue" href="https://client.example/bye">`) {
+		t.Errorf("logout page does not link to the post-logout redirect URI:\n%s", page)
+	}
+	if script := page[strings.Index(page, "<script>"):]; strings.Contains(script, "client.example/bye") {
+		t.Errorf("logout page has the post-logout redirect URI in a script:\n%s", page)
+	}
+
+	page = logout("javascript:alert(document.domain)")
+	if strings.Contains(page, "alert(") && !strings.Contains(page, "Invalid post_logout_redirect_uri") {
+		t.Errorf("logout page redirects to a javascript: URI:\n%s", page)
+	}
+}
+
+// checkSession does what the check_session_iframe does with the cookies of a browser:
+// it reports whether the session_state of the test client is still valid.
+func checkSession(t *testing.T, browser *http.Client, ts *httptest.Server, sessionState string) bool {
+	t.Helper()
+	u, _ := url.Parse(ts.URL + "/oidc/check_session.html")
+	var browserState string
+	for _, cookie := range browser.Jar.Cookies(u) {
+		if cookie.Name == "jambo_browser_state" {
+			browserState = cookie.Value
+		}
+	}
+	salt := sessionState[strings.LastIndex(sessionState, ".")+1:]
+	sum := sha256.Sum256([]byte(testClientID + " https://client.example " + browserState + " " + salt))
+	return hex.EncodeToString(sum[:])+"."+salt == sessionState
+}
+
+func TestSessionStateAfterLogout(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetSessionTimeouts(time.Minute, time.Hour)
+
+	// newSession returns a browser with a session, and the session_state sent to the client.
+	newSession := func() (*http.Client, string) {
+		browser := newBrowser(ts)
+		location, page := authorize(t, browser, ts, authParams(nil))
+		if location == nil {
+			t.Fatalf("not redirected to the client:\n%s", page)
+		}
+		sessionState := location.Query().Get("session_state")
+		if sessionState == "" || !checkSession(t, browser, ts, sessionState) {
+			t.Fatalf("redirected to %s; want a session_state matching the browser state", location)
+		}
+		return browser, sessionState
+	}
+
+	browser, sessionState := newSession()
+	resp, err := browser.PostForm(ts.URL+"/oidc/logout", url.Values{"confirm": {"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+	if checkSession(t, browser, ts, sessionState) {
+		t.Error("session_state unchanged after RP-initiated logout")
+	}
+
+	browser, sessionState = newSession()
+	if err := s.LogoutUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	location, _ := authorize(t, browser, ts, authParams(url.Values{"prompt": {"none"}}))
+	if location == nil || location.Query().Get("error") != "login_required" {
+		t.Errorf("prompt=none after LogoutUser: redirected to %v; want login_required", location)
+	}
+	if checkSession(t, browser, ts, sessionState) {
+		t.Error("session_state unchanged after LogoutUser")
+	}
+}
+
+func TestSessionCookiesExpiration(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetSessionTimeouts(time.Minute, time.Hour)
+
+	resp := login(t, newBrowser(ts), ts, authParams(nil), "alice")
+	readBody(t, resp)
+	for _, cookie := range resp.Cookies() {
+		if cookie.MaxAge <= 0 || cookie.MaxAge > 60 {
+			t.Errorf("cookie %s has Max-Age %d; want the idle timeout of the session (60)", cookie.Name, cookie.MaxAge)
+		}
+	}
+	if len(resp.Cookies()) != 2 {
+		t.Errorf("login sets cookies %v; want the session and browser state cookies", resp.Cookies())
+	}
+}
+
+// logoutRequest sends a request to the RP-initiated logout endpoint.  It returns where
+// the browser is redirected to or, if it is not redirected, nil and the page shown.
+func logoutRequest(t *testing.T, browser *http.Client, ts *httptest.Server, params url.Values) (*url.URL, string) {
+	t.Helper()
+	resp, err := browser.Get(ts.URL + "/oidc/logout?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readBody(t, resp)
+	if resp.StatusCode != http.StatusFound {
+		return nil, page
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location, ""
+}
+
+func TestRPInitiatedLogout(t *testing.T) {
+	_, ts := newTestServer(t, func(c *jambo.Client) { c.AddAllowedPostLogoutRedirectURIs("https://client.example/bye") })
+
+	// newSession returns a browser with a session, and the ID token sent to the client.
+	newSession := func() (*http.Client, string) {
+		browser := newBrowser(ts)
+		status, tokens := postForm(t, ts, "/token", url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {authCode(t, browser, ts, authParams(nil))},
+			"redirect_uri": {testRedirectURI},
+		})
+		if status != http.StatusOK {
+			t.Fatalf("token endpoint: status %d: %v", status, tokens)
+		}
+		return browser, tokens["id_token"].(string)
+	}
+	params := url.Values{
+		"client_id":                {testClientID},
+		"post_logout_redirect_uri": {"https://client.example/bye"},
+		"state":                    {"logout-state"},
+	}
+
+	// Without id_token_hint, the user has to confirm the logout.
+	browser, _ := newSession()
+	location, page := logoutRequest(t, browser, ts, params)
+	if location != nil || !strings.Contains(page, `<p>Do you want to log out alice?</p>`) {
+		t.Fatalf("logout without id_token_hint: redirected to %v; want the confirmation page:\n%s", location, page)
+	}
+	if authRedirect(t, browser, ts, authParams(nil)) == nil {
+		t.Error("logout not confirmed: login form shown; want the session to be kept")
+	}
+	form := url.Values{"confirm": {"true"}}
+	for _, m := range formPostInputRE.FindAllStringSubmatch(page, -1) {
+		form.Set(m[1], html.UnescapeString(m[2]))
+	}
+	resp, err := browser.PostForm(ts.URL+"/oidc/logout", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Location"); got != "https://client.example/bye?state=logout-state" {
+		t.Errorf("logout confirmed: redirected to %q; want the post_logout_redirect_uri with the state", got)
+	}
+	if location := authRedirect(t, browser, ts, authParams(nil)); location != nil {
+		t.Errorf("after logout: redirected to %s; want the login form", location)
+	}
+
+	// With an ID token of the session, it is not asked.
+	browser, idToken := newSession()
+	params.Set("id_token_hint", idToken)
+	if location, page := logoutRequest(t, browser, ts, params); location == nil || location.String() != "https://client.example/bye?state=logout-state" {
+		t.Errorf("logout with id_token_hint: redirected to %v; want the post_logout_redirect_uri with the state:\n%s", location, page)
+	}
+	if location := authRedirect(t, browser, ts, authParams(nil)); location != nil {
+		t.Errorf("after logout with id_token_hint: redirected to %s; want the login form", location)
+	}
+
+	// An ID token of another session is not enough.
+	browser, _ = newSession()
+	if location, page := logoutRequest(t, browser, ts, params); location != nil || !strings.Contains(page, `id="submit-logout"`) {
+		t.Errorf("logout with id_token_hint of another session: redirected to %v; want the confirmation page:\n%s", location, page)
+	}
+
+	// Without a session, there is nothing to confirm.
+	if location, page := logoutRequest(t, newBrowser(ts), ts, params); location == nil || location.Query().Get("state") != "logout-state" {
+		t.Errorf("logout without a session: redirected to %v; want the post_logout_redirect_uri:\n%s", location, page)
+	}
+}
+
+func TestRPInitiatedLogoutErrors(t *testing.T) {
+	s, ts := newTestServer(t, func(c *jambo.Client) { c.AddAllowedPostLogoutRedirectURIs("https://client.example/bye") })
+	other := s.NewClient("other-client", testClientSecret)
+	other.AddAllowedPostLogoutRedirectURIs("https://other.example/bye")
+	idToken := getTokens(t, ts, authParams(nil))["id_token"].(string)
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   string
+	}{
+		{"unregistered post_logout_redirect_uri",
+			url.Values{"client_id": {testClientID}, "post_logout_redirect_uri": {"https://other.example/bye"}},
+			`Unregistered post_logout_redirect_uri ("https://other.example/bye")`},
+		{"post_logout_redirect_uri without client",
+			url.Values{"post_logout_redirect_uri": {"https://client.example/bye"}},
+			`Unregistered post_logout_redirect_uri ("https://client.example/bye")`},
+		{"unknown client",
+			url.Values{"client_id": {"unknown"}},
+			`unknown client "unknown"`},
+		{"client_id not matching id_token_hint",
+			url.Values{"client_id": {"other-client"}, "id_token_hint": {idToken}, "post_logout_redirect_uri": {"https://other.example/bye"}},
+			`"client_id" does not match the audience of "id_token_hint"`},
+		{"invalid id_token_hint",
+			url.Values{"id_token_hint": {"hint"}},
+			"invalid id_token_hint"},
+	}
+	for _, test := range tests {
+		location, page := logoutRequest(t, newBrowser(ts), ts, test.params)
+		if location != nil || !strings.Contains(html.UnescapeString(page), test.want) {
+			t.Errorf("%s: redirected to %v, page %q; want an error %q", test.name, location, page, test.want)
+		}
+	}
+
+	// The client is taken from id_token_hint.
+	location, page := logoutRequest(t, newBrowser(ts), ts, url.Values{"id_token_hint": {idToken}, "post_logout_redirect_uri": {"https://client.example/bye"}})
+	if location == nil || location.String() != "https://client.example/bye" {
+		t.Errorf("logout with id_token_hint and no client_id: redirected to %v; want the post_logout_redirect_uri:\n%s", location, page)
+	}
+}
+
+var frontchannelRE = regexp.MustCompile(`<iframe class="frontchannel-logout" src="([^"]*)"`)
+
+func TestFrontchannelLogout(t *testing.T) {
+	s, ts := newTestServer(t, func(c *jambo.Client) { c.SetFrontchannelLogoutURI("https://client.example/logout?app=1") })
+	other := s.NewClient("other-client", testClientSecret)
+	other.AddAllowedRedirectURIs(testRedirectURI)
+	other.SetFrontchannelLogoutURI("https://other.example/logout")
+
+	// Only the test client gets tokens in the session, so only it is notified.
+	browser := newBrowser(ts)
+	location, page := authorize(t, browser, ts, authParams(nil))
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	idToken := clientIDToken(t, ts, testClientID, location)
+	authRedirect(t, browser, ts, authParams(url.Values{"client_id": {"other-client"}}))
+
+	resp, err := browser.PostForm(ts.URL+"/oidc/logout", url.Values{"confirm": {"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page = readBody(t, resp)
+	frames := frontchannelRE.FindAllStringSubmatch(page, -1)
+	if len(frames) != 1 {
+		t.Fatalf("logout page loads %d front-channel logout URIs; want 1:\n%s", len(frames), page)
+	}
+	u, err := url.Parse(html.UnescapeString(frames[0][1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Host != "client.example" || u.Path != "/logout" || q.Get("app") != "1" || q.Get("iss") != ts.URL+"/oidc" || q.Get("sid") != idToken["sid"] {
+		t.Errorf("front-channel logout URI %s; want https://client.example/logout with app, iss and sid %v", u, idToken["sid"])
+	}
+	if strings.Contains(page, "jamboContinue") {
+		t.Errorf("logout page without post_logout_redirect_uri redirects:\n%s", page)
+	}
+}
+
+func TestCheckSession(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := ts.Client().Get(ts.URL + "/oidc/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var discovery map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &discovery)
+	for _, name := range []string{"frontchannel_logout_supported", "frontchannel_logout_session_supported", "backchannel_logout_supported", "backchannel_logout_session_supported"} {
+		if discovery[name] != true {
+			t.Errorf("discovery has %s %v; want true", name, discovery[name])
+		}
+	}
+	if discovery["check_session_iframe"] != ts.URL+"/oidc/check_session.html" {
+		t.Errorf("discovery has check_session_iframe %v; want %s", discovery["check_session_iframe"], ts.URL+"/oidc/check_session.html")
+	}
+	resp, err = ts.Client().Get(ts.URL + "/oidc/check_session.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page := readBody(t, resp); resp.StatusCode != http.StatusOK || !strings.Contains(page, `"jambo_browser_state="`) {
+		t.Errorf("check_session_iframe: status %d; want the page reading the browser state cookie:\n%s", resp.StatusCode, page)
+	}
+
+	// The iframe can read the browser state cookie, but not the session cookie.
+	browser := newBrowser(ts)
+	resp = login(t, browser, ts, authParams(nil), "alice")
+	resp.Body.Close()
+	for _, cookie := range resp.Cookies() {
+		if cookie.HttpOnly != (cookie.Name != "jambo_browser_state") {
+			t.Errorf("cookie %s has HttpOnly %v", cookie.Name, cookie.HttpOnly)
+		}
+	}
+
+	// The session_state changes with a new session, and depends on the client origin.
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	sessionState := location.Query().Get("session_state")
+	if !checkSession(t, browser, ts, sessionState) {
+		t.Fatalf("session_state %q does not match the browser state", sessionState)
+	}
+	if next := authRedirect(t, browser, ts, authParams(nil)).Query().Get("session_state"); next == sessionState || !checkSession(t, browser, ts, next) {
+		t.Errorf("session_state %q with the same session; want a new salt matching the browser state", next)
+	}
+	u, _ := url.Parse(ts.URL + "/oidc/check_session.html")
+	for _, cookie := range browser.Jar.Cookies(u) {
+		if cookie.Name == "jambo_browser_state" {
+			salt := sessionState[strings.LastIndex(sessionState, ".")+1:]
+			sum := sha256.Sum256([]byte(testClientID + " https://other.example " + cookie.Value + " " + salt))
+			if hex.EncodeToString(sum[:])+"."+salt == sessionState {
+				t.Error("session_state matches another origin")
+			}
+		}
+	}
+	login(t, browser, ts, authParams(url.Values{"prompt": {"login"}}), "alice").Body.Close()
+	if checkSession(t, browser, ts, sessionState) {
+		t.Error("session_state unchanged after logging in again")
+	}
+}
@@ -0,0 +1,178 @@
+package jambo
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Mutual-TLS client authentication methods (RFC 8705, section 2):
+const (
+	authMethodTLSClientAuth           = "tls_client_auth"             // certificate issued by a trusted CA
+	authMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth" // certificate registered by the client
+)
+
+// A Confirmation is the "cnf" claim of a token bound to a key (RFC 7800).
+type Confirmation struct {
+	// SHA-256 thumbprint of the client certificate (RFC 8705, section 3.1).
+	X5tS256 string `json:"x5t#S256,omitempty"`
+
+	// JWK SHA-256 thumbprint of the DPoP key (RFC 9449, section 6.1).
+	JKT string `json:"jkt,omitempty"`
+}
+
+// SetClientCAs sets the certificate authorities used to verify the client
+// certificates for the "tls_client_auth" authentication method.
+//
+// The HTTPS server must request client certificates without verifying them
+// (tls.RequestClientCert or tls.VerifyClientCertIfGiven), because the server
+// checks them itself, and self-signed certificates can also be used.
+func (s *Server) SetClientCAs(pool *x509.CertPool) {
+	s.clientCAs = pool
+}
+
+// SetTLSClientAuthSubjectDN sets the subject distinguished name (such as
+// "CN=client,O=Example") of the certificate used by a client to authenticate itself
+// with "tls_client_auth".  The certificate must be issued by one of the CAs
+// set with [Server.SetClientCAs].
+func (c *Client) SetTLSClientAuthSubjectDN(dn string) {
+	c.tlsClientAuthSubjectDN = dn
+}
+
+// SetTLSClientAuthSANDNS sets the DNS name which must be in the subject alternative names
+// of the certificate used by a client to authenticate itself with "tls_client_auth",
+// instead of its subject.  It is ignored if the subject is set.
+func (c *Client) SetTLSClientAuthSANDNS(name string) {
+	c.tlsClientAuthSANDNS = name
+}
+
+// AddTLSClientCertificates adds self-signed certificates a client can use to
+// authenticate itself with "self_signed_tls_client_auth".
+// The certificates in the "x5c" parameter of the keys of the client are also accepted.
+func (c *Client) AddTLSClientCertificates(certs ...*x509.Certificate) {
+	for _, cert := range certs {
+		c.tlsClientCertThumbprints = append(c.tlsClientCertThumbprints, certThumbprint(cert))
+	}
+}
+
+// SetCertificateBoundAccessTokens specifies whether the access tokens issued to a client
+// are bound to the certificate it uses in the TLS connection to the token endpoint.
+// Bound tokens are only accepted by the userinfo endpoint over a TLS connection
+// with the same certificate, and the introspection endpoint returns its thumbprint.
+func (c *Client) SetCertificateBoundAccessTokens(bound bool) {
+	c.certificateBoundAccessTokens = bound
+}
+
+// certThumbprint returns the base64url-encoded SHA-256 hash of a certificate.
+func certThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// clientCertificate returns the certificate sent by the client in the TLS connection, if any.
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// authenticateClientCertificate checks the certificate sent by a client
+// in the TLS connection ("tls_client_auth" or "self_signed_tls_client_auth").
+func (s *Server) authenticateClientCertificate(w http.ResponseWriter, r *http.Request, cert *x509.Certificate) *Client {
+	clientID := r.PostFormValue("client_id")
+	client := s.findClient(clientID)
+	err := errors.New("unknown client")
+	if client != nil {
+		err = s.verifyClientCertificate(client, r, cert)
+	}
+	if err != nil {
+		if _DEBUG {
+			log.Printf("%s %s %s: invalid client certificate for client_id=%q: %v\n", r.RemoteAddr, r.Method, r.URL.Path, clientID, err)
+		}
+		writeJSONError(w, http.StatusUnauthorized, "invalid_client", "Invalid client certificate.")
+		return nil
+	}
+	return client
+}
+
+// verifyClientCertificate checks if a client can authenticate itself with a certificate.
+func (s *Server) verifyClientCertificate(c *Client, r *http.Request, cert *x509.Certificate) error {
+	if (c.tlsClientAuthSubjectDN != "" || c.tlsClientAuthSANDNS != "") && c.allowsAuthMethod(authMethodTLSClientAuth) && s.clientCAs != nil {
+		intermediates := x509.NewCertPool()
+		for _, ic := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(ic)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         s.clientCAs,
+			Intermediates: intermediates,
+			CurrentTime:   time.Now(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err == nil && c.tlsClientAuthSubjectDN != "" && cert.Subject.String() == c.tlsClientAuthSubjectDN {
+			return nil
+		}
+		if err == nil && c.tlsClientAuthSubjectDN == "" && slices.Contains(cert.DNSNames, c.tlsClientAuthSANDNS) {
+			return nil
+		}
+	}
+
+	if c.allowsAuthMethod(authMethodSelfSignedTLSClientAuth) {
+		if time.Now().After(cert.NotAfter) || time.Now().Before(cert.NotBefore) {
+			return errors.New("certificate expired or not yet valid")
+		}
+		thumbprint := certThumbprint(cert)
+		if slices.Contains(c.tlsClientCertThumbprints, thumbprint) {
+			return nil
+		}
+		if c.jwksURI != "" || len(c.jwks.Keys) > 0 {
+			keys, err := s.clientKeys(c, "")
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if len(key.Certificates) > 0 && certThumbprint(key.Certificates[0]) == thumbprint {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("certificate %q not registered", cert.Subject)
+}
+
+// confirmation returns the "cnf" claim for the access tokens issued in a request to the token
+// endpoint, with the thumbprint of the DPoP key (jkt) if any, or nil if they are not bound.
+// It returns an error if they must be bound but the client has not sent a certificate or a DPoP proof.
+func (s *Server) confirmation(c *Client, r *http.Request, jkt string) (*Confirmation, error) {
+	var cnf Confirmation
+	if c.certificateBoundAccessTokens {
+		cert := clientCertificate(r)
+		if cert == nil {
+			return nil, errors.New("a client certificate is required")
+		}
+		cnf.X5tS256 = certThumbprint(cert)
+	}
+	if c.dpopBoundAccessTokens && jkt == "" {
+		return nil, errors.New("a DPoP proof is required")
+	}
+	cnf.JKT = jkt
+	if cnf == (Confirmation{}) {
+		return nil, nil
+	}
+	return &cnf, nil
+}
+
+// checkConfirmation checks that a bound access token is used with the right certificate.
+func checkConfirmation(cnf *Confirmation, r *http.Request) bool {
+	if cnf == nil || cnf.X5tS256 == "" {
+		return true
+	}
+	cert := clientCertificate(r)
+	return cert != nil && certThumbprint(cert) == cnf.X5tS256
+}
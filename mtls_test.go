@@ -0,0 +1,214 @@
+package jambo_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+// newCertificate creates a certificate for client authentication, signed by parent
+// (or self-signed, if parent is nil).
+func newCertificate(t *testing.T, subject pkix.Name, dnsNames []string, isCA bool, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	issuer, signer := template, any(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// newTLSTestServer is like newTestServer, but the server is started with TLS and
+// requests a client certificate.  Its client CAs are the ones in pool.
+func newTLSTestServer(t *testing.T, pool *x509.CertPool) (*jambo.Server, *httptest.Server) {
+	t.Helper()
+	mux := http.NewServeMux()
+	ts := httptest.NewUnstartedServer(mux)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	s := setupTestServer(ts, mux)
+	s.SetClientCAs(pool)
+	return s, ts
+}
+
+// certClient returns an HTTP client for ts which sends a certificate, if cert is not nil.
+func certClient(ts *httptest.Server, cert *tls.Certificate) *http.Client {
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// certTokens exchanges an authorization code of a client authenticated with a certificate.
+// It returns the status code and the decoded response of the token endpoint.
+func certTokens(t *testing.T, ts *httptest.Server, clientID string, cert *tls.Certificate) (int, map[string]any) {
+	t.Helper()
+	code := authCode(t, newBrowser(ts), ts, authParams(url.Values{"client_id": {clientID}}))
+	resp, err := certClient(ts, cert).PostForm(ts.URL+"/oidc/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {testRedirectURI},
+		"client_id":    {clientID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	return resp.StatusCode, body
+}
+
+func TestTLSClientAuth(t *testing.T) {
+	ca := newCertificate(t, pkix.Name{CommonName: "Test CA"}, nil, true, nil)
+	otherCA := newCertificate(t, pkix.Name{CommonName: "Other CA"}, nil, true, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	s, ts := newTLSTestServer(t, pool)
+
+	subject := pkix.Name{CommonName: "client", Organization: []string{"Example"}}
+	clientCert := newCertificate(t, subject, []string{"client.example"}, false, &ca)
+	otherCert := newCertificate(t, pkix.Name{CommonName: "other"}, []string{"other.example"}, false, &ca)
+	untrustedCert := newCertificate(t, subject, []string{"client.example"}, false, &otherCA)
+
+	c := s.NewClient("dn-client", "")
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetTokenEndpointAuthMethod("tls_client_auth")
+	c.SetTLSClientAuthSubjectDN("CN=client,O=Example")
+
+	c = s.NewClient("san-client", "")
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetTokenEndpointAuthMethod("tls_client_auth")
+	c.SetTLSClientAuthSANDNS("client.example")
+
+	tests := []struct {
+		clientID string
+		cert     *tls.Certificate
+		wantOK   bool
+	}{
+		{"dn-client", &clientCert, true},
+		{"dn-client", &otherCert, false},
+		{"dn-client", &untrustedCert, false},
+		{"dn-client", nil, false},
+		{"san-client", &clientCert, true},
+		{"san-client", &otherCert, false},
+		{"san-client", &untrustedCert, false},
+	}
+	for _, test := range tests {
+		status, body := certTokens(t, ts, test.clientID, test.cert)
+		subject := "no certificate"
+		if test.cert != nil {
+			subject = test.cert.Leaf.Subject.String() + " from " + test.cert.Leaf.Issuer.String()
+		}
+		if test.wantOK && status != http.StatusOK {
+			t.Errorf("%s with %s: status %d: %v; want %d", test.clientID, subject, status, body, http.StatusOK)
+		}
+		if !test.wantOK && (status != http.StatusUnauthorized || body["error"] != "invalid_client") {
+			t.Errorf("%s with %s: status %d: %v; want %d, invalid_client", test.clientID, subject, status, body, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestSelfSignedTLSClientAuth(t *testing.T) {
+	s, ts := newTLSTestServer(t, x509.NewCertPool())
+	clientCert := newCertificate(t, pkix.Name{CommonName: "client"}, nil, false, nil)
+	otherCert := newCertificate(t, pkix.Name{CommonName: "client"}, nil, false, nil)
+
+	c := s.NewClient("self-signed-client", "")
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetTokenEndpointAuthMethod("self_signed_tls_client_auth")
+	c.AddTLSClientCertificates(clientCert.Leaf)
+
+	if status, body := certTokens(t, ts, "self-signed-client", &clientCert); status != http.StatusOK {
+		t.Errorf("registered certificate: status %d: %v; want %d", status, body, http.StatusOK)
+	}
+	for name, cert := range map[string]*tls.Certificate{"another certificate": &otherCert, "no certificate": nil} {
+		if status, body := certTokens(t, ts, "self-signed-client", cert); status != http.StatusUnauthorized || body["error"] != "invalid_client" {
+			t.Errorf("%s: status %d: %v; want %d, invalid_client", name, status, body, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestCertificateBoundAccessTokens(t *testing.T) {
+	s, ts := newTLSTestServer(t, x509.NewCertPool())
+	clientCert := newCertificate(t, pkix.Name{CommonName: "client"}, nil, false, nil)
+	otherCert := newCertificate(t, pkix.Name{CommonName: "other"}, nil, false, nil)
+
+	c := s.NewClient("bound-client", "")
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetTokenEndpointAuthMethod("self_signed_tls_client_auth")
+	c.AddTLSClientCertificates(clientCert.Leaf)
+	c.SetCertificateBoundAccessTokens(true)
+
+	status, tokens := certTokens(t, ts, "bound-client", &clientCert)
+	if status != http.StatusOK {
+		t.Fatalf("token endpoint: status %d: %v", status, tokens)
+	}
+	accessToken := tokens["access_token"].(string)
+	sum := sha256.Sum256(clientCert.Leaf.Raw)
+	cnf, _ := jwtClaims(t, accessToken)["cnf"].(map[string]any)
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); cnf["x5t#S256"] != want {
+		t.Errorf("access token has cnf %v; want x5t#S256 %s", cnf, want)
+	}
+
+	userInfo := func(cert *tls.Certificate) map[string]any {
+		req, _ := http.NewRequest("GET", ts.URL+"/oidc/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := certClient(ts, cert).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]any
+		json.Unmarshal([]byte(readBody(t, resp)), &body)
+		return body
+	}
+	if body := userInfo(&clientCert); body["sub"] != "alice" {
+		t.Errorf("userinfo with the bound certificate: %v; want sub alice", body)
+	}
+	for name, cert := range map[string]*tls.Certificate{"another certificate": &otherCert, "no certificate": nil} {
+		if body := userInfo(cert); body["error"] != "invalid_token" {
+			t.Errorf("userinfo with %s: %v; want invalid_token", name, body)
+		}
+	}
+}
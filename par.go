@@ -0,0 +1,108 @@
+package jambo
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// requestURIPrefix is the prefix of the "request_uri" values returned by the
+// pushed authorization request endpoint (RFC 9126, section 2.2).
+const requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// pushedRequestLifetime is the time a pushed authorization request can be used.
+const pushedRequestLifetime = 90 * time.Second
+
+// Parameters used to authenticate the client, which are not part of a pushed authorization request:
+var clientAuthParams = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+// SetRequirePushedAuthorizationRequests specifies whether a client can only send
+// authorization requests using the pushed authorization request endpoint ("/par").
+func (c *Client) SetRequirePushedAuthorizationRequests(require bool) {
+	c.requirePAR = require
+}
+
+// openIDPushedAuth is the handler for the pushed authorization request endpoint ("/par"),
+// defined in RFC 9126.  Clients send the parameters of an authorization request,
+// and get a "request_uri" to use in its place in the authorization endpoint.
+func (s *Server) openIDPushedAuth(w http.ResponseWriter, r *http.Request) {
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	params := url.Values{}
+	for key, values := range r.PostForm {
+		if !slices.Contains(clientAuthParams, key) {
+			params[key] = values
+		}
+	}
+	if params.Has("request_uri") {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "request_uri cannot be pushed.")
+		return
+	}
+	if clientID := params.Get("client_id"); clientID != "" && clientID != client.id {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "client_id does not match the authenticated client.")
+		return
+	}
+	params.Set("client_id", client.id)
+	params, err := s.requestObjectParams(params)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request_object", err.Error())
+		return
+	}
+	if rt := normalizeResponseType(params.Get("response_type")); !slices.Contains(responseTypesSupported, rt) || !client.allowsResponseType(rt) {
+		writeJSONError(w, http.StatusBadRequest, "unsupported_response_type", "Unsupported response_type.")
+		return
+	}
+	if !slices.Contains(client.allowedRedirectURIs, params.Get("redirect_uri")) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "Unregistered redirect_uri.")
+		return
+	}
+
+	requestURI := requestURIPrefix + rand.Text()
+	err = s.storage.Put(bucketRequestURIs, requestURI, []byte(params.Encode()), time.Now().Add(pushedRequestLifetime))
+	if err != nil {
+		http.Error(w, "Internal server error storing request.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"request_uri": requestURI,
+		"expires_in":  int(pushedRequestLifetime.Seconds()),
+	})
+}
+
+// authParams returns the parameters of an authorization request: those sent
+// to the authorization endpoint (or in a request object), or, if it has a "request_uri"
+// returned by the pushed authorization request endpoint, those pushed by the client.
+// Each pushed request can only be used once.
+func (s *Server) authParams(r *http.Request) (url.Values, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	clientID := r.Form.Get("client_id")
+	requestURI := r.Form.Get("request_uri")
+	if !strings.HasPrefix(requestURI, requestURIPrefix) {
+		if c := s.findClient(clientID); c != nil && c.requirePAR {
+			return nil, errors.New("this client must use pushed authorization requests")
+		}
+		return s.requestObjectParams(r.Form)
+	}
+
+	data, err := s.storage.Take(bucketRequestURIs, requestURI)
+	if err != nil {
+		return nil, errors.New("invalid or expired request_uri")
+	}
+	params, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if params.Get("client_id") != clientID {
+		return nil, errors.New("client_id does not match the pushed request")
+	}
+	return params, nil
+}
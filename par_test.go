@@ -0,0 +1,140 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+// expiringStorage is a Storage where the pushed authorization requests expire as soon
+// as they are stored.
+type expiringStorage struct {
+	jambo.Storage
+}
+
+func (s expiringStorage) Put(bucket, key string, value []byte, expires time.Time) error {
+	if strings.HasPrefix(key, "urn:ietf:params:oauth:request_uri:") {
+		expires = time.Now().Add(-time.Second)
+	}
+	return s.Storage.Put(bucket, key, value, expires)
+}
+
+// pushRequest pushes an authorization request from the test client, with the parameters
+// of authParams and those in extra, and returns its request_uri.
+func pushRequest(t *testing.T, ts *httptest.Server, extra url.Values) string {
+	t.Helper()
+	status, body := postForm(t, ts, "/par", authParams(extra))
+	requestURI, _ := body["request_uri"].(string)
+	if status != http.StatusCreated || !strings.HasPrefix(requestURI, "urn:ietf:params:oauth:request_uri:") {
+		t.Fatalf("/par: status %d: %v; want %d and a request_uri", status, body, http.StatusCreated)
+	}
+	if body["expires_in"] != 90.0 {
+		t.Errorf("/par: expires_in %v; want 90", body["expires_in"])
+	}
+	return requestURI
+}
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	s, ts := newTestServer(t)
+	other := s.NewClient("other", testClientSecret)
+	other.AddAllowedRedirectURIs(testRedirectURI)
+
+	// The pushed parameters are used, and the request_uri can only be used once.
+	requestURI := pushRequest(t, ts, url.Values{"state": {"pushed"}})
+	params := url.Values{"client_id": {testClientID}, "request_uri": {requestURI}, "state": {"outside"}}
+	location, page := authorize(t, newBrowser(ts), ts, params)
+	if location == nil || location.Query().Get("state") != "pushed" || location.Query().Get("code") == "" {
+		t.Errorf("pushed request: redirected to %v; want a code and state pushed:\n%s", location, page)
+	}
+	if location, page := authorize(t, newBrowser(ts), ts, params); location != nil || !strings.Contains(page, "invalid or expired request_uri") {
+		t.Errorf("request_uri used twice: redirected to %v, page %q; want an error", location, page)
+	}
+
+	// Another client cannot use it.
+	params.Set("request_uri", pushRequest(t, ts, nil))
+	params.Set("client_id", "other")
+	if location, page := authorize(t, newBrowser(ts), ts, params); location != nil || !strings.Contains(page, "client_id does not match") {
+		t.Errorf("request_uri of another client: redirected to %v, page %q; want an error", location, page)
+	}
+
+	// A request_uri which has expired is rejected.
+	s.SetStorage(expiringStorage{jambo.NewMemoryStorage()})
+	params = url.Values{"client_id": {testClientID}, "request_uri": {pushRequest(t, ts, nil)}}
+	if location, page := authorize(t, newBrowser(ts), ts, params); location != nil || !strings.Contains(page, "invalid or expired request_uri") {
+		t.Errorf("expired request_uri: redirected to %v, page %q; want an error", location, page)
+	}
+}
+
+func TestPushedAuthorizationRequestErrors(t *testing.T) {
+	s, ts := newTestServer(t)
+	other := s.NewClient("other", "other-secret")
+	other.AddAllowedRedirectURIs(testRedirectURI)
+
+	post := func(params url.Values) (int, map[string]any) {
+		t.Helper()
+		resp, err := ts.Client().PostForm(ts.URL+"/oidc/par", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]any
+		json.Unmarshal([]byte(readBody(t, resp)), &body)
+		return resp.StatusCode, body
+	}
+	withSecret := func(secret string, extra url.Values) url.Values {
+		params := authParams(extra)
+		if secret != "" {
+			params.Set("client_secret", secret)
+		}
+		return params
+	}
+
+	tests := []struct {
+		name       string
+		params     url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{"no secret", withSecret("", nil), http.StatusUnauthorized, "invalid_client"},
+		{"wrong secret", withSecret("wrong", nil), http.StatusUnauthorized, "invalid_client"},
+		{"unregistered redirect_uri", withSecret(testClientSecret, url.Values{"redirect_uri": {"https://attacker.example/cb"}}), http.StatusBadRequest, "invalid_request"},
+		{"pushed request_uri", withSecret(testClientSecret, url.Values{"request_uri": {"urn:ietf:params:oauth:request_uri:x"}}), http.StatusBadRequest, "invalid_request"},
+		{"unsupported response_type", withSecret(testClientSecret, url.Values{"response_type": {"token"}}), http.StatusBadRequest, "unsupported_response_type"},
+	}
+	for _, test := range tests {
+		status, body := post(test.params)
+		if status != test.wantStatus || body["error"] != test.wantError {
+			t.Errorf("%s: status %d: %v; want %d, %s", test.name, status, body, test.wantStatus, test.wantError)
+		}
+	}
+
+	// The client authenticated must be the one in client_id.
+	params := authParams(url.Values{"client_id": {"other"}})
+	req, _ := http.NewRequest("POST", ts.URL+"/oidc/par", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(testClientID, testClientSecret)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "client_id does not match") {
+		t.Errorf("request for another client: status %d: %s; want %d", resp.StatusCode, body, http.StatusBadRequest)
+	}
+}
+
+func TestRequirePushedAuthorizationRequests(t *testing.T) {
+	_, ts := newTestServer(t, func(c *jambo.Client) { c.SetRequirePushedAuthorizationRequests(true) })
+
+	if location, page := authorize(t, newBrowser(ts), ts, authParams(nil)); location != nil || !strings.Contains(page, "must use pushed authorization requests") {
+		t.Errorf("request without PAR: redirected to %v, page %q; want an error", location, page)
+	}
+	params := url.Values{"client_id": {testClientID}, "request_uri": {pushRequest(t, ts, nil)}}
+	if location, page := authorize(t, newBrowser(ts), ts, params); location == nil || location.Query().Get("code") == "" {
+		t.Errorf("pushed request: redirected to %v; want a code:\n%s", location, page)
+	}
+}
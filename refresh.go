@@ -0,0 +1,84 @@
+package jambo
+
+import (
+	"crypto/rand"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// refreshTokenLifetime is the time a refresh token is valid if it is not used.
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
+// newRefreshToken issues a refresh token for a connection.
+// Only the SHA-256 hash of the token is kept in the Storage.
+func (s *Server) newRefreshToken(conn *Connection) (string, error) {
+	data, err := conn.marshal()
+	if err != nil {
+		return "", err
+	}
+	token := rand.Text()
+	err = s.storage.Put(bucketRefreshTokens, hashToken(token), data, time.Now().Add(refreshTokenLifetime))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// loadRefreshToken returns the connection a refresh token was issued for,
+// or nil if it is not valid.
+func (s *Server) loadRefreshToken(token string) *Connection {
+	data, err := s.storage.Get(bucketRefreshTokens, hashToken(token))
+	if err != nil {
+		return nil
+	}
+	return s.unmarshalConnection(data)
+}
+
+// refreshGrant handles a "refresh_token" grant (RFC 6749, section 6).
+// It returns the connection used to issue the new tokens, with the scopes
+// requested by the client, and the connection used to issue a new refresh token.
+// Refresh tokens are rotated: each of them can only be used once.  If they are bound to a DPoP key,
+// the request must have a proof made with the same key (jkt is the thumbprint of its key).
+// If the request is not valid, it sends an error response and returns nil.
+func (s *Server) refreshGrant(w http.ResponseWriter, r *http.Request, client *Client, jkt string) (conn, refresh *Connection) {
+	token := r.PostFormValue("refresh_token")
+	if token == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "Required param: refresh_token.")
+		return nil, nil
+	}
+
+	refresh = s.loadRefreshToken(token)
+	if refresh == nil || refresh.client.id != client.id {
+		if _DEBUG {
+			log.Printf("%s POST /token: invalid refresh_token\n", r.RemoteAddr)
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token.")
+		return nil, nil
+	}
+	if refresh.dpopJKT != "" && refresh.dpopJKT != jkt {
+		writeJSONError(w, http.StatusBadRequest, "invalid_grant", "Refresh token bound to another DPoP key.")
+		return nil, nil
+	}
+
+	granted := *refresh
+	if scope := r.PostFormValue("scope"); scope != "" {
+		granted.scopes = strings.Fields(scope)
+		for _, scope := range granted.scopes {
+			if !slices.Contains(refresh.scopes, scope) {
+				writeJSONError(w, http.StatusBadRequest, "invalid_scope", `Scope "`+scope+`" was not granted.`)
+				return nil, nil
+			}
+		}
+	}
+	// The ID tokens issued with a refresh token do not have a nonce.
+	granted.nonce = ""
+
+	if _, err := s.storage.Take(bucketRefreshTokens, hashToken(token)); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token.")
+		return nil, nil
+	}
+	return &granted, refresh
+}
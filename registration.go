@@ -0,0 +1,381 @@
+package jambo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// clientMetadata holds the metadata of a client, as used in
+// Dynamic Client Registration (RFC 7591 and OpenID Connect).
+type clientMetadata struct {
+	RedirectURIs            []string            `json:"redirect_uris"`
+	ClientName              string              `json:"client_name,omitempty"`
+	TokenEndpointAuthMethod string              `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string            `json:"grant_types,omitempty"`
+	ResponseTypes           []string            `json:"response_types,omitempty"`
+	Scope                   string              `json:"scope,omitempty"`
+	PostLogoutRedirectURIs  []string            `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutURI    string              `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutURI   string              `json:"frontchannel_logout_uri,omitempty"`
+	DefaultACRValues        []string            `json:"default_acr_values,omitempty"`
+	JWKSURI                 string              `json:"jwks_uri,omitempty"`
+	JWKS                    *jose.JSONWebKeySet `json:"jwks,omitempty"`
+	RequestURIs             []string            `json:"request_uris,omitempty"`
+
+	TLSClientAuthSubjectDN                string `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANDNS                   string `json:"tls_client_auth_san_dns,omitempty"`
+	TLSClientCertificateBoundAccessTokens bool   `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	DPoPBoundAccessTokens                 bool   `json:"dpop_bound_access_tokens,omitempty"`
+	RequirePushedAuthorizationRequests    bool   `json:"require_pushed_authorization_requests,omitempty"`
+	RequireSignedRequestObject            bool   `json:"require_signed_request_object,omitempty"`
+	AuthorizationSignedResponseAlg        string `json:"authorization_signed_response_alg,omitempty"`
+}
+
+// registrationResponse is the response to a successful registration request (RFC 7591, section 3.2.1)
+// or a client read or update request (RFC 7592, section 3).
+type registrationResponse struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	clientMetadata
+}
+
+// AddInitialAccessToken adds a token that can be used (as a bearer token)
+// to register new clients using the registration endpoint.
+func (s *Server) AddInitialAccessToken(token string) {
+	s.initialAccessTokens = append(s.initialAccessTokens, token)
+}
+
+// SetOpenRegistration specifies whether anyone can register new clients,
+// without an initial access token.
+func (s *Server) SetOpenRegistration(open bool) {
+	s.openRegistration = open
+}
+
+// SetRegisteredSecretLifetime sets the time the secrets issued to dynamically
+// registered clients are valid, which is sent to them in "client_secret_expires_at".
+// By default, they do not expire.
+func (s *Server) SetRegisteredSecretLifetime(d time.Duration) {
+	s.registeredSecretLifetime = d
+}
+
+// registrationEnabled reports whether clients can be registered dynamically.
+func (s *Server) registrationEnabled() bool {
+	return s.openRegistration || len(s.initialAccessTokens) > 0
+}
+
+// bearerToken returns the bearer token sent in the "Authorization" header of a request.
+func bearerToken(r *http.Request) string {
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	if len(fields) != 2 || fields[0] != "Bearer" {
+		return ""
+	}
+	return fields[1]
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// metadata returns the registration metadata of a client.
+func (c *Client) metadata() clientMetadata {
+	m := clientMetadata{
+		RedirectURIs:            c.allowedRedirectURIs,
+		ClientName:              c.name,
+		TokenEndpointAuthMethod: c.tokenEndpointAuthMethod,
+		GrantTypes:              []string{grantTypeAuthorizationCode, grantTypeRefreshToken},
+		ResponseTypes:           append([]string{responseTypeCode}, c.responseTypes...),
+		Scope:                   strings.Join(append(slices.Clone(scopesSupported), c.allowedScopes...), " "),
+		PostLogoutRedirectURIs:  c.allowedPostLogoutRedirectURIs,
+		BackchannelLogoutURI:    c.backchannelLogoutURI,
+		FrontchannelLogoutURI:   c.frontchannelLogoutURI,
+		DefaultACRValues:        c.defaultACRValues,
+		JWKSURI:                 c.jwksURI,
+		RequestURIs:             c.requestURIs,
+
+		TLSClientAuthSubjectDN:                c.tlsClientAuthSubjectDN,
+		TLSClientAuthSANDNS:                   c.tlsClientAuthSANDNS,
+		TLSClientCertificateBoundAccessTokens: c.certificateBoundAccessTokens,
+		DPoPBoundAccessTokens:                 c.dpopBoundAccessTokens,
+		RequirePushedAuthorizationRequests:    c.requirePAR,
+		RequireSignedRequestObject:            c.requireSignedRequestObject,
+		AuthorizationSignedResponseAlg:        c.authorizationResponseAlg,
+	}
+	if len(c.responseTypes) > 0 {
+		m.GrantTypes = append(m.GrantTypes, grantTypeImplicit)
+	}
+	if len(c.jwks.Keys) > 0 {
+		m.JWKS = &c.jwks
+	}
+	return m
+}
+
+// validate checks the metadata sent in a registration request, filling in the default values.
+// Besides the supported scopes, the client can keep the extra ones in allowedScopes
+// (those it already has, when it updates its registration), but not add new ones.
+// It returns the error code and description to send to the client.
+func (m *clientMetadata) validate(allowedScopes []string) (string, string) {
+	if len(m.RedirectURIs) == 0 {
+		return "invalid_redirect_uri", "at least one redirect_uri is required"
+	}
+	for _, uri := range slices.Concat(m.RedirectURIs, m.PostLogoutRedirectURIs) {
+		if err := checkRedirectURI(uri); err != nil {
+			return "invalid_redirect_uri", err.Error()
+		}
+	}
+	if uri := m.FrontchannelLogoutURI; uri != "" {
+		if err := checkRedirectURI(uri); err != nil {
+			return "invalid_client_metadata", err.Error()
+		}
+	}
+	for _, uri := range []string{m.BackchannelLogoutURI, m.JWKSURI} {
+		if uri == "" {
+			continue
+		}
+		if err := checkWebURI(uri); err != nil {
+			return "invalid_client_metadata", err.Error()
+		}
+	}
+	for _, uri := range m.RequestURIs {
+		// The fragment of a request_uri can have the hash of its content (OpenID Connect Core, section 6.2).
+		base, _, _ := strings.Cut(uri, "#")
+		if err := checkWebURI(base); err != nil {
+			return "invalid_client_metadata", err.Error()
+		}
+	}
+
+	if m.TokenEndpointAuthMethod == "" {
+		m.TokenEndpointAuthMethod = authMethodSecretBasic
+	}
+	if !slices.Contains(authMethodsSupported, m.TokenEndpointAuthMethod) {
+		return "invalid_client_metadata", fmt.Sprintf("unsupported token_endpoint_auth_method %q", m.TokenEndpointAuthMethod)
+	}
+	if m.JWKSURI != "" && m.JWKS != nil {
+		return "invalid_client_metadata", "jwks_uri and jwks cannot be used together"
+	}
+	if m.JWKS != nil {
+		for _, key := range m.JWKS.Keys {
+			if !key.Valid() || !key.IsPublic() {
+				return "invalid_client_metadata", fmt.Sprintf("invalid public key %q in jwks", key.KeyID)
+			}
+		}
+	}
+	switch m.TokenEndpointAuthMethod {
+	case authMethodPrivateKeyJWT, authMethodSelfSignedTLSClientAuth:
+		if m.JWKSURI == "" && m.JWKS == nil {
+			return "invalid_client_metadata", m.TokenEndpointAuthMethod + " requires jwks_uri or jwks"
+		}
+	case authMethodTLSClientAuth:
+		if m.TLSClientAuthSubjectDN == "" && m.TLSClientAuthSANDNS == "" {
+			return "invalid_client_metadata", "tls_client_auth requires tls_client_auth_subject_dn or tls_client_auth_san_dns"
+		}
+	}
+	if alg := m.AuthorizationSignedResponseAlg; alg != "" && !slices.Contains(authorizationSigningAlgs, jose.SignatureAlgorithm(alg)) {
+		return "invalid_client_metadata", fmt.Sprintf("unsupported authorization_signed_response_alg %q", alg)
+	}
+	for _, grantType := range m.GrantTypes {
+		if grantType != grantTypeAuthorizationCode && grantType != grantTypeRefreshToken && grantType != grantTypeImplicit {
+			return "invalid_client_metadata", fmt.Sprintf("unsupported grant_type %q", grantType)
+		}
+	}
+	for _, responseType := range m.ResponseTypes {
+		if !slices.Contains(responseTypesSupported, normalizeResponseType(responseType)) {
+			return "invalid_client_metadata", fmt.Sprintf("unsupported response_type %q", responseType)
+		}
+	}
+	for _, scope := range strings.Fields(m.Scope) {
+		if !slices.Contains(scopesSupported, scope) && !slices.Contains(allowedScopes, scope) {
+			return "invalid_client_metadata", fmt.Sprintf("unsupported scope %q", scope)
+		}
+	}
+	return "", ""
+}
+
+// checkWebURI checks a URI registered by a client which the server fetches or posts to:
+// it must be an https URL without a fragment.
+func checkWebURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("invalid URI %q", uri)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("URI %q must use https", uri)
+	}
+	return nil
+}
+
+// checkRedirectURI checks a URI registered by a client where the browser is sent.
+// It is like checkWebURI, but http is also accepted for localhost and loopback addresses,
+// which are used by native apps and in development.
+func checkRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err == nil && u.Scheme == "http" && u.Host != "" && u.Fragment == "" {
+		if ip := net.ParseIP(u.Hostname()); u.Hostname() == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return checkWebURI(uri)
+}
+
+// setMetadata updates a client with the metadata sent in a registration request.
+func (c *Client) setMetadata(m clientMetadata) {
+	c.name = m.ClientName
+	c.tokenEndpointAuthMethod = m.TokenEndpointAuthMethod
+	c.allowedRedirectURIs = m.RedirectURIs
+	c.allowedPostLogoutRedirectURIs = m.PostLogoutRedirectURIs
+	c.backchannelLogoutURI = m.BackchannelLogoutURI
+	c.frontchannelLogoutURI = m.FrontchannelLogoutURI
+	c.defaultACRValues = m.DefaultACRValues
+	c.jwksURI = m.JWKSURI
+	c.tlsClientAuthSubjectDN = m.TLSClientAuthSubjectDN
+	c.tlsClientAuthSANDNS = m.TLSClientAuthSANDNS
+	c.certificateBoundAccessTokens = m.TLSClientCertificateBoundAccessTokens
+	c.dpopBoundAccessTokens = m.DPoPBoundAccessTokens
+	c.requirePAR = m.RequirePushedAuthorizationRequests
+	c.requestURIs = m.RequestURIs
+	c.requireSignedRequestObject = m.RequireSignedRequestObject
+	c.authorizationResponseAlg = m.AuthorizationSignedResponseAlg
+	c.responseTypes = nil
+	c.AddAllowedResponseTypes(m.ResponseTypes...)
+	c.jwks = jose.JSONWebKeySet{}
+	if m.JWKS != nil {
+		c.jwks = *m.JWKS
+	}
+	c.allowedScopes = nil
+	for _, scope := range strings.Fields(m.Scope) {
+		if !slices.Contains(scopesSupported, scope) {
+			c.allowedScopes = append(c.allowedScopes, scope)
+		}
+	}
+}
+
+// registrationResponse returns the registration information of a client.
+func (s *Server) registrationResponse(c *Client) registrationResponse {
+	return registrationResponse{
+		ClientID:              c.id,
+		ClientSecret:          c.plainSecret(),
+		ClientSecretExpiresAt: c.secretExpiresAt(),
+		RegistrationClientURI: s.issuer + "/register/" + url.PathEscape(c.id),
+		clientMetadata:        c.metadata(),
+	}
+}
+
+// openIDRegister is the handler for the Client Registration endpoint ("/register").
+// https://datatracker.ietf.org/doc/html/rfc7591
+func (s *Server) openIDRegister(w http.ResponseWriter, r *http.Request) {
+	if !s.registrationEnabled() {
+		writeJSONError(w, http.StatusForbidden, "access_denied", "Client registration is disabled.")
+		return
+	}
+	if !s.openRegistration {
+		token := bearerToken(r)
+		if !slices.ContainsFunc(s.initialAccessTokens, func(t string) bool {
+			return subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1
+		}) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid initial access token.")
+			return
+		}
+	}
+
+	var m clientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+	if code, description := m.validate(nil); code != "" {
+		writeJSONError(w, http.StatusBadRequest, code, description)
+		return
+	}
+
+	registrationAccessToken := rand.Text()
+	c := &Client{
+		id:                      rand.Text(),
+		registrationAccessToken: hashToken(registrationAccessToken),
+	}
+	var notAfter time.Time
+	if s.registeredSecretLifetime > 0 {
+		notAfter = time.Now().Add(s.registeredSecretLifetime)
+	}
+	// The secret is long enough to be used as a HS512 key (for client_secret_jwt).
+	c.AddSecret(rand.Text()+rand.Text()+rand.Text(), notAfter)
+	c.setMetadata(m)
+	if err := s.clients.CreateClient(c); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	resp := s.registrationResponse(c)
+	resp.ClientIDIssuedAt = time.Now().Unix()
+	resp.RegistrationAccessToken = registrationAccessToken
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// openIDRegistration is the handler for the Client Configuration endpoint
+// ("/register/{client_id}"), used to read, update or delete a registered client.
+// https://datatracker.ietf.org/doc/html/rfc7592
+func (s *Server) openIDRegistration(w http.ResponseWriter, r *http.Request) {
+	c := s.findClient(r.PathValue("client_id"))
+	token := bearerToken(r)
+	if c == nil || c.registrationAccessToken == "" ||
+		subtle.ConstantTimeCompare([]byte(c.registrationAccessToken), []byte(hashToken(token))) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid registration access token.")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.registrationResponse(c))
+	case http.MethodPut:
+		var req struct {
+			ClientID     string `json:"client_id"`
+			ClientSecret string `json:"client_secret"`
+			clientMetadata
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+			return
+		}
+		if req.ClientID != c.id || (req.ClientSecret != "" && c.checkSecret(req.ClientSecret) == nil) {
+			writeJSONError(w, http.StatusBadRequest, "invalid_client_metadata", "client_id and client_secret cannot be changed.")
+			return
+		}
+		if code, description := req.clientMetadata.validate(c.allowedScopes); code != "" {
+			writeJSONError(w, http.StatusBadRequest, code, description)
+			return
+		}
+		updated := *c
+		updated.setMetadata(req.clientMetadata)
+		if err := s.clients.UpdateClient(&updated); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.registrationResponse(&updated))
+	case http.MethodDelete:
+		if err := s.clients.DeleteClient(c.id); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,94 @@
+package jambo_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// register sends a client registration request, returning the status code and the response.
+func register(t *testing.T, url string, metadata map[string]any) (int, map[string]any) {
+	t.Helper()
+	data, _ := json.Marshal(metadata)
+	resp, err := http.Post(url+"/oidc/register", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	return resp.StatusCode, body
+}
+
+func TestRegistrationURIs(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetOpenRegistration(true)
+
+	tests := []struct {
+		metadata  map[string]any
+		wantError string // empty if the registration must succeed
+	}{
+		{map[string]any{"redirect_uris": []string{"https://app.example/cb"}}, ""},
+		{map[string]any{"redirect_uris": []string{"http://localhost:8080/cb"}}, ""},
+		{map[string]any{"redirect_uris": []string{"http://127.0.0.1/cb", "http://[::1]:9000/cb"}}, ""},
+		{map[string]any{"redirect_uris": []string{"http://app.example/cb"}}, "invalid_redirect_uri"},
+		{map[string]any{"redirect_uris": []string{"https://app.example/cb#fragment"}}, "invalid_redirect_uri"},
+		{map[string]any{"redirect_uris": []string{"javascript:alert(1)"}}, "invalid_redirect_uri"},
+		{map[string]any{"redirect_uris": []string{"data:text/html,<script>alert(1)</script>"}}, "invalid_redirect_uri"},
+		{map[string]any{"redirect_uris": []string{"com.example.app:/cb"}}, "invalid_redirect_uri"},
+		{map[string]any{"redirect_uris": []string{"https://app.example/cb"}, "scope": "openid profile"}, ""},
+		{map[string]any{"redirect_uris": []string{"https://app.example/cb"}, "scope": "openid billing:read"}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris":             []string{"https://app.example/cb"},
+			"post_logout_redirect_uris": []string{"javascript:alert(1)"},
+		}, "invalid_redirect_uri"},
+		{map[string]any{
+			"redirect_uris":           []string{"https://app.example/cb"},
+			"frontchannel_logout_uri": "javascript:alert(1)",
+		}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris":          []string{"https://app.example/cb"},
+			"backchannel_logout_uri": "http://internal.example/logout",
+		}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris":           []string{"http://localhost/cb"},
+			"frontchannel_logout_uri": "http://localhost/logout",
+		}, ""},
+		{map[string]any{
+			"redirect_uris":          []string{"http://localhost/cb"},
+			"backchannel_logout_uri": "http://localhost/logout",
+		}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris": []string{"https://app.example/cb"},
+			"jwks_uri":      "http://127.0.0.1/jwks",
+		}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris": []string{"https://app.example/cb"},
+			"request_uris":  []string{"https://app.example/request#hash"},
+		}, ""},
+		{map[string]any{
+			"redirect_uris": []string{"https://app.example/cb"},
+			"request_uris":  []string{"http://169.254.169.254/latest/meta-data/"},
+		}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris": []string{"https://app.example/cb"},
+			"request_uris":  []string{"http://10.0.0.1/"},
+		}, "invalid_client_metadata"},
+		{map[string]any{
+			"redirect_uris": []string{"https://app.example/cb"},
+			"request_uris":  []string{"file:///etc/passwd"},
+		}, "invalid_client_metadata"},
+	}
+	for _, test := range tests {
+		status, body := register(t, ts.URL, test.metadata)
+		if test.wantError == "" {
+			if status != http.StatusCreated {
+				t.Errorf("register %v: status %d (%v); want %d", test.metadata, status, body, http.StatusCreated)
+			}
+			continue
+		}
+		if status != http.StatusBadRequest || body["error"] != test.wantError {
+			t.Errorf("register %v: status %d, error %v; want %d, %s", test.metadata, status, body["error"], http.StatusBadRequest, test.wantError)
+		}
+	}
+}
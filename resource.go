@@ -0,0 +1,223 @@
+package jambo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Formats of the access tokens issued for an API resource:
+const (
+	TokenFormatJWT    = "jwt"    // a JWT signed by the server, which the API can check itself
+	TokenFormatOpaque = "opaque" // a random string, which the API checks with the introspection endpoint
+)
+
+// An APIResource is a protected resource (an API) that clients can request
+// access tokens for, with the "resource" parameter (RFC 8707).
+type APIResource struct {
+	// Identifier is an absolute URI, used in the "resource" parameter
+	// and as the audience of the access tokens.
+	Identifier string
+
+	// Name is shown in the consent screen.  If empty, the identifier is used.
+	Name string
+
+	// Scopes are the scopes defined by the API.  Clients can only use those granted to them.
+	Scopes []string
+
+	// TokenFormat is the format of its access tokens: TokenFormatJWT (the default)
+	// or TokenFormatOpaque.
+	TokenFormat string
+
+	// Lifetime is the time its access tokens are valid.  If zero, they are valid for one hour.
+	Lifetime time.Duration
+
+	allClients bool // added with AddResource: all the clients can use it, with all its scopes
+}
+
+// AddAPIResource registers an API resource.  Clients must be granted access
+// to it with [Client.GrantAPIResource] before they can use it.
+func (s *Server) AddAPIResource(res APIResource) {
+	s.resources = append(s.resources, res)
+}
+
+// AddResource registers a protected resource, identified by an absolute URI,
+// with the scopes that can be used with it.  Unlike the ones added with
+// [Server.AddAPIResource], all the clients can ask for access tokens for it,
+// with the scopes they are allowed to use.
+//
+// Deprecated: use [Server.AddAPIResource] and [Client.GrantAPIResource].
+func (s *Server) AddResource(uri string, scopes ...string) {
+	s.AddAPIResource(APIResource{Identifier: uri, Scopes: scopes, allClients: true})
+}
+
+// GrantAPIResource allows a client to request access tokens for an API resource,
+// given by its identifier, with some of its scopes.  The client can request these
+// scopes in the "scope" parameter like any other allowed scope.
+func (c *Client) GrantAPIResource(identifier string, scopes ...string) {
+	if c.apiResources == nil {
+		c.apiResources = make(map[string][]string)
+	}
+	c.apiResources[identifier] = append(c.apiResources[identifier], scopes...)
+}
+
+// findResource returns the API resource with a given identifier, or nil if it is not registered.
+func (s *Server) findResource(identifier string) *APIResource {
+	for i := range s.resources {
+		if s.resources[i].Identifier == identifier {
+			return &s.resources[i]
+		}
+	}
+	return nil
+}
+
+// grantedScopes returns the scopes of an API resource granted to a client.
+func (c *Client) grantedScopes(res *APIResource) []string {
+	if res.allClients {
+		return res.Scopes
+	}
+	return slices.DeleteFunc(slices.Clone(c.apiResources[res.Identifier]), func(scope string) bool {
+		return !slices.Contains(res.Scopes, scope)
+	})
+}
+
+// allowsAPIScope reports whether a scope of some API resource has been granted to a client.
+// The scopes of the resources added with AddResource must be allowed like any other scope.
+func (s *Server) allowsAPIScope(c *Client, scope string) bool {
+	for i := range s.resources {
+		if !s.resources[i].allClients && slices.Contains(c.grantedScopes(&s.resources[i]), scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResources checks the values of the "resource" parameters of a request from a client.
+// All of them must be API resources granted to it, with the same token format.
+func (s *Server) checkResources(c *Client, identifiers []string) error {
+	var format string
+	for i, identifier := range identifiers {
+		u, err := url.Parse(identifier)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("invalid resource %q", identifier)
+		}
+		res := s.findResource(identifier)
+		if res == nil {
+			return fmt.Errorf("unknown resource %q", identifier)
+		}
+		if _, ok := c.apiResources[identifier]; !ok && !res.allClients {
+			return fmt.Errorf("resource %q is not allowed for this client", identifier)
+		}
+		if i > 0 && res.tokenFormat() != format {
+			return errors.New("resources with different token formats cannot be used together")
+		}
+		format = res.tokenFormat()
+	}
+	return nil
+}
+
+// tokenResources returns the resources an access token is issued for: those
+// requested in the token request, which must have been granted in the authorization
+// request if it had any, or else all the granted ones.
+func (s *Server) tokenResources(conn *Connection, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return conn.resources, nil
+	}
+	if err := s.checkResources(conn.client, requested); err != nil {
+		return nil, err
+	}
+	for _, identifier := range requested {
+		if len(conn.resources) > 0 && !slices.Contains(conn.resources, identifier) {
+			return nil, fmt.Errorf("resource %q was not granted", identifier)
+		}
+	}
+	return requested, nil
+}
+
+// resourceScopes returns the scopes of an access token issued for some resources:
+// the granted scopes that the client can use with any of them.  Without resources,
+// all the granted scopes are used.
+func (s *Server) resourceScopes(conn *Connection, resources []string) []string {
+	if len(resources) == 0 {
+		return conn.scopes
+	}
+	var narrowed []string
+	for _, scope := range conn.scopes {
+		if slices.ContainsFunc(resources, func(identifier string) bool {
+			res := s.findResource(identifier)
+			return res != nil && slices.Contains(conn.client.grantedScopes(res), scope)
+		}) {
+			narrowed = append(narrowed, scope)
+		}
+	}
+	return narrowed
+}
+
+// tokenFormat returns the format of the access tokens of an API resource.
+func (res *APIResource) tokenFormat() string {
+	if res.TokenFormat == "" {
+		return TokenFormatJWT
+	}
+	return res.TokenFormat
+}
+
+// lifetime returns the time the access tokens of an API resource are valid.
+func (res *APIResource) lifetime() time.Duration {
+	if res.Lifetime == 0 {
+		return accessTokenLifetime
+	}
+	return res.Lifetime
+}
+
+// accessTokenSettings returns the format and lifetime of an access token issued for
+// some resources (which must have the same format): the shortest of their lifetimes.
+func (s *Server) accessTokenSettings(resources []string) (format string, lifetime time.Duration) {
+	format = TokenFormatJWT
+	for _, identifier := range resources {
+		res := s.findResource(identifier)
+		if res == nil {
+			continue
+		}
+		format = res.tokenFormat()
+		if l := res.lifetime(); lifetime == 0 || l < lifetime {
+			lifetime = l
+		}
+	}
+	if lifetime == 0 {
+		lifetime = accessTokenLifetime
+	}
+	return format, lifetime
+}
+
+// A consentAPI is an API resource shown in the consent screen, with the requested scopes.
+type consentAPI struct {
+	Name   string
+	Scopes string
+}
+
+// consentAPIs returns the API resources of an authorization request shown in the consent
+// screen: those in its "resource" parameters, and those with scopes in its "scope" parameter.
+func (s *Server) consentAPIs(conn *Connection) []consentAPI {
+	var apis []consentAPI
+	for i := range s.resources {
+		res := &s.resources[i]
+		var scopes []string
+		for _, scope := range conn.client.grantedScopes(res) {
+			if slices.Contains(conn.scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		if len(scopes) == 0 && !slices.Contains(conn.resources, res.Identifier) {
+			continue
+		}
+		name := res.Name
+		if name == "" {
+			name = res.Identifier
+		}
+		apis = append(apis, consentAPI{Name: name, Scopes: strings.Join(scopes, " ")})
+	}
+	return apis
+}
@@ -0,0 +1,134 @@
+package jambo_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cespedes/jambo"
+)
+
+const testAPI = "https://api.example/"
+
+// getResourceTokens runs the authorization code flow in a test server with the API testAPI,
+// which the test client can use with the scope "read".  It returns the responses of
+// the token endpoint without resources (plain) and for testAPI (api).
+func getResourceTokens(t *testing.T) (ts *httptest.Server, plain, api map[string]any) {
+	t.Helper()
+	s, ts := newTestServer(t, func(c *jambo.Client) {
+		c.GrantAPIResource(testAPI, "read")
+	})
+	s.AddAPIResource(jambo.APIResource{Identifier: testAPI, Scopes: []string{"read"}})
+
+	plain = getTokens(t, ts, authParams(nil))
+	api = getTokens(t, ts, authParams(url.Values{
+		"scope":    {"openid profile email read"},
+		"resource": {testAPI},
+	}))
+	return ts, plain, api
+}
+
+func TestResourceAccessTokenClaims(t *testing.T) {
+	_, plain, api := getResourceTokens(t)
+
+	claims := jwtClaims(t, plain["access_token"].(string))
+	if claims["userinfo"] == nil {
+		t.Errorf("access token for the client has no userinfo: %v", claims)
+	}
+
+	claims = jwtClaims(t, api["access_token"].(string))
+	if aud, _ := claims["aud"].(string); aud != testAPI {
+		t.Errorf("access token for %s has aud %v", testAPI, claims["aud"])
+	}
+	if claims["userinfo"] != nil {
+		t.Errorf("access token for %s has the claims of the user: %v", testAPI, claims["userinfo"])
+	}
+}
+
+func TestResourceAccessTokenUserInfo(t *testing.T) {
+	ts, plain, api := getResourceTokens(t)
+
+	if userInfo := getUserInfo(t, ts, plain["access_token"].(string)); userInfo["sub"] != "alice" {
+		t.Errorf("userinfo with an access token for the client: %v; want sub alice", userInfo)
+	}
+	if userInfo := getUserInfo(t, ts, api["access_token"].(string)); userInfo["error"] != "invalid_token" {
+		t.Errorf("userinfo with an access token for %s: %v; want invalid_token", testAPI, userInfo)
+	}
+}
+
+func TestAddResource(t *testing.T) {
+	s, ts := newTestServer(t, func(c *jambo.Client) {
+		c.AddAllowedScopes("read")
+	})
+	s.AddResource("https://legacy.example/", "read")
+
+	tokens := getTokens(t, ts, authParams(url.Values{
+		"scope":    {"openid read"},
+		"resource": {"https://legacy.example/"},
+	}))
+	claims := jwtClaims(t, tokens["access_token"].(string))
+	if claims["aud"] != "https://legacy.example/" || claims["scope"] != "read" {
+		t.Errorf("access token for a resource added with AddResource has aud %v and scope %v", claims["aud"], claims["scope"])
+	}
+}
+
+func TestResourceNarrowing(t *testing.T) {
+	apis := []string{"https://api1.example/", "https://api2.example/", "https://api3.example/"}
+	s, ts := newTestServer(t, func(c *jambo.Client) {
+		c.GrantAPIResource(apis[0], "read")
+		c.GrantAPIResource(apis[1], "write")
+	})
+	s.AddAPIResource(jambo.APIResource{Identifier: apis[0], Scopes: []string{"read", "write"}})
+	s.AddAPIResource(jambo.APIResource{Identifier: apis[1], Scopes: []string{"write"}})
+	s.AddAPIResource(jambo.APIResource{Identifier: apis[2], Scopes: []string{"read"}})
+
+	// token returns the response of the token endpoint for a code issued for the first
+	// two APIs, with the resources requested in the token request.
+	token := func(resources ...string) (int, map[string]any) {
+		code := authCode(t, newBrowser(ts), ts, authParams(url.Values{
+			"scope":    {"openid read write"},
+			"resource": apis[:2],
+		}))
+		return postForm(t, ts, "/token", url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {code},
+			"redirect_uri": {testRedirectURI},
+			"resource":     resources,
+		})
+	}
+
+	tests := []struct {
+		resources []string
+		wantAud   any
+		wantScope string
+	}{
+		{nil, []any{apis[0], apis[1]}, "read write"},
+		{apis[:1], apis[0], "read"},
+		{apis[1:2], apis[1], "write"},
+	}
+	for _, test := range tests {
+		status, tokens := token(test.resources...)
+		if status != http.StatusOK {
+			t.Errorf("resources %v: status %d: %v", test.resources, status, tokens)
+			continue
+		}
+		claims := jwtClaims(t, tokens["access_token"].(string))
+		if fmt.Sprint(claims["aud"]) != fmt.Sprint(test.wantAud) || claims["scope"] != test.wantScope || claims["azp"] != testClientID {
+			t.Errorf("resources %v: access token has aud %v, scope %v and azp %v; want %v, %q and %s",
+				test.resources, claims["aud"], claims["scope"], claims["azp"], test.wantAud, test.wantScope, testClientID)
+		}
+	}
+
+	for _, resource := range []string{apis[2], "https://unknown.example/", "not a URI"} {
+		if status, body := token(resource); status != http.StatusBadRequest || body["error"] != "invalid_target" {
+			t.Errorf("token request for %s: status %d: %v; want invalid_target", resource, status, body)
+		}
+	}
+
+	location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"resource": {apis[2]}}))
+	if location == nil || location.Query().Get("error") != "invalid_target" {
+		t.Errorf("authorization request for an API not granted: redirected to %v; want invalid_target:\n%s", location, page)
+	}
+}
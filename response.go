@@ -0,0 +1,110 @@
+package jambo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Values for the "response_mode" parameter
+// (https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html#ResponseModes):
+const (
+	responseModeQuery    = "query"
+	responseModeFragment = "fragment"
+	responseModeFormPost = "form_post" // https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+)
+
+var responseModesSupported = []string{
+	responseModeQuery,
+	responseModeFragment,
+	responseModeFormPost,
+	responseModeJWT,
+	responseModeQueryJWT,
+	responseModeFragmentJWT,
+	responseModeFormPostJWT,
+}
+
+// authResponse sends an authorization response back to the client,
+// redirecting the user agent to its redirect_uri with the parameters in the
+// query string or in the fragment, or making it post them in an HTML form.
+// With the JARM response modes, the parameters are sent in a signed JWT.
+func (s *Server) authResponse(w http.ResponseWriter, r *http.Request, conn *Connection, params url.Values) {
+	u, err := url.Parse(conn.redirectURI)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("redirect_uri: %v", err), http.StatusBadRequest)
+		return
+	}
+	if conn.state != "" {
+		params.Set("state", conn.state)
+	}
+	// The issuer identifies the server, to prevent mix-up attacks (RFC 9207).
+	params.Set("iss", s.issuer)
+
+	mode := conn.responseMode
+	if strings.HasSuffix(mode, responseModeJWT) {
+		params, mode, err = s.jwtResponse(conn, params)
+		if err != nil {
+			http.Error(w, "Internal server error signing response.", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	switch mode {
+	case responseModeFormPost:
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		s.render(w, r, "formpost.html", map[string]any{
+			"redirectURI": conn.redirectURI,
+			"params":      params,
+		})
+		return
+	case responseModeFragment:
+		u.Fragment = ""
+		http.Redirect(w, r, u.String()+"#"+params.Encode(), http.StatusFound)
+		return
+	}
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// authError sends an error authorization response back to the client.
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthError
+func (s *Server) authError(w http.ResponseWriter, r *http.Request, conn *Connection, code, description string) {
+	params := url.Values{}
+	params.Set("error", code)
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	s.authResponse(w, r, conn, params)
+}
+
+// writeJSON sends a JSON response with a given HTTP status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal server error marshaling response.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)+1))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(data))
+}
+
+// writeJSONError sends an OAuth 2.0 error response.
+func writeJSONError(w http.ResponseWriter, status int, code, description string) {
+	resp := map[string]string{"error": code}
+	if description != "" {
+		resp["error_description"] = description
+	}
+	writeJSON(w, status, resp)
+}
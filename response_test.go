@@ -0,0 +1,123 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	formPostRE      = regexp.MustCompile(`<form id="formpost" method="post" action="([^"]*)">`)
+	formPostInputRE = regexp.MustCompile(`<input type="hidden" name="([^"]*)" value="([^"]*)">`)
+)
+
+// formPost sends an authorization request and logs in as alice.  It returns the
+// response, which must be a form_post page, its action and its parameters.
+func formPost(t *testing.T, ts *httptest.Server, params url.Values) (*http.Response, string, string, url.Values) {
+	t.Helper()
+	resp := login(t, newBrowser(ts), ts, params, "alice")
+	page := readBody(t, resp)
+	m := formPostRE.FindStringSubmatch(page)
+	if resp.StatusCode != http.StatusOK || m == nil {
+		t.Fatalf("form_post response: status %d; want a form:\n%s", resp.StatusCode, page)
+	}
+	values := url.Values{}
+	for _, input := range formPostInputRE.FindAllStringSubmatch(page, -1) {
+		values.Add(html.UnescapeString(input[1]), html.UnescapeString(input[2]))
+	}
+	return resp, page, html.UnescapeString(m[1]), values
+}
+
+func TestFormPostResponseMode(t *testing.T) {
+	_, ts := newTestServer(t)
+	resp, _, action, values := formPost(t, ts, authParams(url.Values{"response_mode": {"form_post"}}))
+	if action != testRedirectURI {
+		t.Errorf("form posted to %q; want %q", action, testRedirectURI)
+	}
+	if values.Get("code") == "" || values.Get("state") != "state" {
+		t.Errorf("form has parameters %v; want a code and the state", values)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control: %q; want no-store", got)
+	}
+
+	// The parameters are escaped in the form.
+	state := `"><script>alert(document.domain)</script>`
+	_, page, _, values := formPost(t, ts, authParams(url.Values{"response_mode": {"form_post"}, "state": {state}}))
+	if strings.Contains(page, "<script>alert(") {
+		t.Errorf("form_post page has an unescaped state:\n%s", page)
+	}
+	if values.Get("state") != state {
+		t.Errorf("form has state %q; want %q", values.Get("state"), state)
+	}
+}
+
+func TestFragmentResponseMode(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_mode": {"fragment"}}))
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	fragment, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Has("code") || fragment.Get("code") == "" || fragment.Get("state") != "state" {
+		t.Errorf("redirected to %s; want the code and the state in the fragment", location)
+	}
+
+	location, page = authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_mode": {"unknown"}}))
+	if location != nil || !strings.Contains(html.UnescapeString(page), `Unsupported response_mode "unknown"`) {
+		t.Errorf("unknown response_mode: redirected to %v, page %q; want an error", location, page)
+	}
+}
+
+func TestIssuerResponseParameter(t *testing.T) {
+	_, ts := newTestServer(t)
+	issuer := ts.URL + "/oidc"
+
+	resp, err := ts.Client().Get(ts.URL + "/oidc/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var discovery map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &discovery)
+	if discovery["authorization_response_iss_parameter_supported"] != true {
+		t.Errorf("discovery has authorization_response_iss_parameter_supported %v; want true",
+			discovery["authorization_response_iss_parameter_supported"])
+	}
+
+	tests := []struct {
+		name   string
+		params url.Values
+	}{
+		{"code", nil},
+		{"error", url.Values{"prompt": {"none"}}},
+		{"fragment", url.Values{"response_mode": {"fragment"}}},
+		{"form_post", url.Values{"response_mode": {"form_post"}}},
+	}
+	for _, test := range tests {
+		var response url.Values
+		if test.name == "form_post" {
+			_, _, _, response = formPost(t, ts, authParams(test.params))
+		} else {
+			location, page := authorize(t, newBrowser(ts), ts, authParams(test.params))
+			if location == nil {
+				t.Fatalf("%s: not redirected to the client:\n%s", test.name, page)
+			}
+			response = location.Query()
+			if test.name == "fragment" {
+				response, _ = url.ParseQuery(location.Fragment)
+			}
+		}
+		if response.Get("iss") != issuer {
+			t.Errorf("%s: response %v; want iss %s", test.name, response, issuer)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package jambo
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"slices"
+	"strings"
+)
+
+// Values for the "response_type" parameter
+// (https://openid.net/specs/openid-connect-core-1_0.html#Authentication):
+const (
+	responseTypeCode        = "code"          // authorization code flow
+	responseTypeIDToken     = "id_token"      // implicit flow
+	responseTypeCodeIDToken = "code id_token" // hybrid flow
+)
+
+var responseTypesSupported = []string{
+	responseTypeCode,
+	responseTypeIDToken,
+	responseTypeCodeIDToken,
+}
+
+// grantTypeImplicit is the grant type used by clients with the implicit flow.
+const grantTypeImplicit = "implicit"
+
+// AddAllowedResponseTypes allows a client to use the implicit ("id_token")
+// or hybrid ("code id_token") flows.  All clients can use the authorization
+// code flow ("code").
+func (c *Client) AddAllowedResponseTypes(responseTypes ...string) {
+	for _, rt := range responseTypes {
+		if rt = normalizeResponseType(rt); rt != responseTypeCode && !slices.Contains(c.responseTypes, rt) {
+			c.responseTypes = append(c.responseTypes, rt)
+		}
+	}
+}
+
+// normalizeResponseType sorts the values of a "response_type" parameter,
+// which can be sent in any order.
+func normalizeResponseType(responseType string) string {
+	values := strings.Fields(responseType)
+	slices.Sort(values)
+	return strings.Join(values, " ")
+}
+
+// allowsResponseType reports whether a client can use a (normalized) response type.
+func (c *Client) allowsResponseType(responseType string) bool {
+	return responseType == responseTypeCode || slices.Contains(c.responseTypes, responseType)
+}
+
+// hasResponseType reports whether a connection asked for a given value in its response type.
+func (conn *Connection) hasResponseType(value string) bool {
+	return slices.Contains(strings.Fields(conn.responseType), value)
+}
+
+// defaultResponseMode returns the response mode used for a response type
+// if the client does not send the "response_mode" parameter.
+// Responses with tokens are not sent in the query string.
+func defaultResponseMode(responseType string) string {
+	if responseType == responseTypeCode {
+		return responseModeQuery
+	}
+	return responseModeFragment
+}
+
+// leftHash returns the hash of a value used in the "at_hash" and "c_hash" claims of an ID token:
+// the base64url encoding of the left-most half of its SHA-256 hash (the ID tokens are signed with RS256).
+func leftHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,101 @@
+package jambo_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cespedes/jambo"
+)
+
+// leftHash returns the value of the "c_hash" or "at_hash" claim for a code or an access token.
+func leftHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func TestImplicitFlow(t *testing.T) {
+	_, ts := newTestServer(t, func(c *jambo.Client) { c.AddAllowedResponseTypes("id_token") })
+
+	location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_type": {"id_token"}, "nonce": {"n-0S6"}}))
+	if location == nil {
+		t.Fatalf("not redirected to the client:\n%s", page)
+	}
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if location.RawQuery != "" || fragment.Has("code") || fragment.Get("id_token") == "" || fragment.Get("state") != "state" {
+		t.Fatalf("redirected to %s; want an ID token and the state in the fragment", location)
+	}
+	claims := jwtClaims(t, fragment.Get("id_token"))
+	if claims["sub"] != "alice" || claims["aud"] != testClientID || claims["nonce"] != "n-0S6" {
+		t.Errorf("ID token has claims %v; want sub alice, aud %s and nonce n-0S6", claims, testClientID)
+	}
+	if claims["c_hash"] != nil || claims["at_hash"] != nil {
+		t.Errorf("ID token has c_hash %v and at_hash %v; want none", claims["c_hash"], claims["at_hash"])
+	}
+}
+
+func TestHybridFlow(t *testing.T) {
+	_, ts := newTestServer(t, func(c *jambo.Client) { c.AddAllowedResponseTypes("code id_token") })
+
+	// The values of response_type can be sent in any order.
+	for _, responseType := range []string{"code id_token", "id_token code"} {
+		location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_type": {responseType}, "nonce": {"n-0S6"}}))
+		if location == nil {
+			t.Fatalf("%s: not redirected to the client:\n%s", responseType, page)
+		}
+		fragment, _ := url.ParseQuery(location.Fragment)
+		code := fragment.Get("code")
+		if code == "" || fragment.Get("id_token") == "" {
+			t.Fatalf("%s: redirected to %s; want a code and an ID token in the fragment", responseType, location)
+		}
+		claims := jwtClaims(t, fragment.Get("id_token"))
+		if claims["c_hash"] != leftHash(code) || claims["nonce"] != "n-0S6" {
+			t.Errorf("%s: ID token has c_hash %v and nonce %v; want %s and n-0S6", responseType, claims["c_hash"], claims["nonce"], leftHash(code))
+		}
+
+		// The ID token returned by the token endpoint has the hash of the access token.
+		status, tokens := postForm(t, ts, "/token", url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {code},
+			"redirect_uri": {testRedirectURI},
+		})
+		if status != http.StatusOK {
+			t.Fatalf("%s: token endpoint: status %d: %v", responseType, status, tokens)
+		}
+		claims = jwtClaims(t, tokens["id_token"].(string))
+		if want := leftHash(tokens["access_token"].(string)); claims["at_hash"] != want || claims["nonce"] != "n-0S6" {
+			t.Errorf("%s: ID token from the token endpoint has at_hash %v and nonce %v; want %s and n-0S6", responseType, claims["at_hash"], claims["nonce"], want)
+		}
+	}
+}
+
+func TestImplicitFlowErrors(t *testing.T) {
+	s, ts := newTestServer(t, func(c *jambo.Client) { c.AddAllowedResponseTypes("id_token") })
+	other := s.NewClient("code-only", testClientSecret)
+	other.AddAllowedRedirectURIs(testRedirectURI)
+
+	// Clients not allowed to use the implicit flow get an error page.
+	params := authParams(url.Values{"client_id": {"code-only"}, "response_type": {"id_token"}, "nonce": {"n"}})
+	if location, page := authorize(t, newBrowser(ts), ts, params); location != nil || !strings.Contains(html.UnescapeString(page), `Unsupported response_type "id_token"`) {
+		t.Errorf("implicit flow with a client not allowed to: redirected to %v, page %q; want an error", location, page)
+	}
+
+	// Tokens are never sent in the query string.
+	params = authParams(url.Values{"response_type": {"id_token"}, "nonce": {"n"}, "response_mode": {"query"}})
+	if location, page := authorize(t, newBrowser(ts), ts, params); location != nil || !strings.Contains(html.UnescapeString(page), `Unsupported response_mode "query"`) {
+		t.Errorf("implicit flow with response_mode=query: redirected to %v, page %q; want an error", location, page)
+	}
+
+	// The nonce is required.
+	location, page := authorize(t, newBrowser(ts), ts, authParams(url.Values{"response_type": {"id_token"}}))
+	if location == nil {
+		t.Fatalf("implicit flow without nonce: not redirected to the client:\n%s", page)
+	}
+	if fragment, _ := url.ParseQuery(location.Fragment); fragment.Get("error") != "invalid_request" || fragment.Has("id_token") {
+		t.Errorf("implicit flow without nonce: redirected to %s; want invalid_request in the fragment", location)
+	}
+}
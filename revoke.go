@@ -0,0 +1,68 @@
+package jambo
+
+import (
+	"net/http"
+	"time"
+)
+
+// openIDRevoke is the handler for the token revocation endpoint ("/revoke"),
+// defined in RFC 7009.  It accepts refresh tokens and access tokens.
+func (s *Server) openIDRevoke(w http.ResponseWriter, r *http.Request) {
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "Required param: token.")
+		return
+	}
+
+	// The "token_type_hint" parameter is only an optimization, so it is ignored.
+	owner := s.revokeRefreshToken(client, token)
+	if owner == "" {
+		owner = s.revokeAccessToken(client, token)
+	}
+	if owner != "" && owner != client.id {
+		writeJSONError(w, http.StatusBadRequest, "unauthorized_client", "The token was issued to another client.")
+		return
+	}
+
+	// Invalid tokens do not cause an error response.
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// revokeRefreshToken revokes a refresh token, if it was issued to a client.
+// It returns the ID of the client the token was issued to, or "" if it is not a valid refresh token.
+func (s *Server) revokeRefreshToken(client *Client, token string) string {
+	conn := s.loadRefreshToken(token)
+	if conn == nil {
+		return ""
+	}
+	if conn.client.id == client.id {
+		s.storage.Delete(bucketRefreshTokens, hashToken(token))
+	}
+	return conn.client.id
+}
+
+// revokeAccessToken revokes an access token, if it was issued to a client.
+// Its ID is kept in the Storage until it expires.
+// It returns the ID of the client the token was issued to, or "" if it is not a valid access token.
+func (s *Server) revokeAccessToken(client *Client, token string) string {
+	accessToken, err := s.parseAccessToken(token)
+	if err != nil || accessToken.ID == "" {
+		return ""
+	}
+	if accessToken.ClientID == client.id {
+		s.storage.Put(bucketRevocations, accessToken.ID, nil, time.Unix(accessToken.Expiration, 0))
+	}
+	return accessToken.ClientID
+}
+
+// accessTokenRevoked reports whether an access token has been revoked.
+func (s *Server) accessTokenRevoked(accessToken *AccessToken) bool {
+	_, err := s.storage.Get(bucketRevocations, accessToken.ID)
+	return err == nil
+}
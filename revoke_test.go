@@ -0,0 +1,115 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRefreshToken(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	if tokens := getTokens(t, ts, authParams(nil)); tokens["refresh_token"] != nil {
+		t.Errorf("tokens without offline_access: %v; want no refresh token", tokens)
+	}
+	tokens := getTokens(t, ts, authParams(url.Values{"scope": {"openid profile offline_access"}}))
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if refreshToken == "" {
+		t.Fatalf("tokens with offline_access: %v; want a refresh token", tokens)
+	}
+
+	// Only scopes already granted can be asked for.
+	status, body := postForm(t, ts, "/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"scope":         {"openid email"},
+	})
+	if status != http.StatusBadRequest || body["error"] != "invalid_scope" {
+		t.Errorf("refresh with a scope not granted: status %d: %v; want invalid_scope", status, body)
+	}
+	status, body = postForm(t, ts, "/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"scope":         {"openid offline_access"},
+	})
+	if status != http.StatusOK || body["scope"] != "openid offline_access" || body["access_token"] == nil || body["id_token"] == nil {
+		t.Fatalf("refresh: status %d: %v; want new tokens with scope openid offline_access", status, body)
+	}
+	if claims := jwtClaims(t, body["id_token"].(string)); claims["sub"] != "alice" || claims["nonce"] != nil {
+		t.Errorf("ID token from a refresh token has sub %v and nonce %v; want alice and none", claims["sub"], claims["nonce"])
+	}
+
+	// Refresh tokens are rotated, so the old one cannot be used again.
+	next, _ := body["refresh_token"].(string)
+	if next == "" || next == refreshToken {
+		t.Fatalf("refresh: refresh token %q; want a new one", next)
+	}
+	status, body = postForm(t, ts, "/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+	if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("refresh token used twice: status %d: %v; want invalid_grant", status, body)
+	}
+	status, body = postForm(t, ts, "/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {next}})
+	if status != http.StatusOK {
+		t.Errorf("refresh with the new refresh token: status %d: %v", status, body)
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	s, ts := newTestServer(t)
+	other := s.NewClient("other-client", testClientSecret)
+	other.AddAllowedRedirectURIs(testRedirectURI)
+
+	tokens := getTokens(t, ts, authParams(url.Values{"scope": {"openid profile offline_access"}}))
+	refreshToken := tokens["refresh_token"].(string)
+	accessToken := tokens["access_token"].(string)
+
+	// A client cannot revoke the tokens of another one.
+	resp, err := ts.Client().PostForm(ts.URL+"/oidc/revoke", url.Values{
+		"client_id":     {"other-client"},
+		"client_secret": {testClientSecret},
+		"token":         {refreshToken},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "unauthorized_client" {
+		t.Errorf("revoke a token of another client: status %d: %v; want unauthorized_client", resp.StatusCode, body)
+	}
+	if _, body := postForm(t, ts, "/introspect", url.Values{"token": {refreshToken}}); body["active"] != true {
+		t.Errorf("refresh token after another client tried to revoke it: introspection %v; want active", body)
+	}
+
+	// Revoked refresh tokens cannot be used.
+	if status, body := postForm(t, ts, "/revoke", url.Values{"token": {refreshToken}}); status != http.StatusOK {
+		t.Fatalf("revoke refresh token: status %d: %v", status, body)
+	}
+	status, body := postForm(t, ts, "/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+	if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("revoked refresh token: status %d: %v; want invalid_grant", status, body)
+	}
+
+	// Revoked access tokens are inactive, and rejected by the userinfo endpoint.
+	if _, body := postForm(t, ts, "/introspect", url.Values{"token": {accessToken}}); body["active"] != true {
+		t.Fatalf("access token before revocation: introspection %v; want active", body)
+	}
+	if status, body := postForm(t, ts, "/revoke", url.Values{"token": {accessToken}}); status != http.StatusOK {
+		t.Fatalf("revoke access token: status %d: %v", status, body)
+	}
+	if _, body := postForm(t, ts, "/introspect", url.Values{"token": {accessToken}}); body["active"] != false {
+		t.Errorf("revoked access token: introspection %v; want inactive", body)
+	}
+	if claims := getUserInfo(t, ts, accessToken); claims["error"] != "invalid_token" || claims["sub"] != nil {
+		t.Errorf("userinfo with a revoked access token: %v; want invalid_token", claims)
+	}
+
+	// Unknown tokens are not an error, but a missing one is.
+	if status, body := postForm(t, ts, "/revoke", url.Values{"token": {"unknown"}}); status != http.StatusOK {
+		t.Errorf("revoke unknown token: status %d: %v; want 200", status, body)
+	}
+	if status, body := postForm(t, ts, "/revoke", url.Values{}); status != http.StatusBadRequest || body["error"] != "invalid_request" {
+		t.Errorf("revoke without token: status %d: %v; want invalid_request", status, body)
+	}
+}
@@ -0,0 +1,143 @@
+package jambo
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms which can be used to hash the client secrets (see [HashSecret]):
+const (
+	SecretHashArgon2id = "argon2id"      // "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>"
+	SecretHashBcrypt   = "bcrypt"        // "$2a$10$..."
+	SecretHashPBKDF2   = "pbkdf2-sha256" // "$pbkdf2-sha256$i=600000$<salt>$<hash>"
+)
+
+// Parameters used to hash new secrets:
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // in KiB
+	argon2Threads = 4
+	pbkdf2Iter    = 600000
+	saltLength    = 16
+	keyLength     = 32
+)
+
+// HashSecret returns the hash of a client secret using a given algorithm
+// (one of SecretHashArgon2id, SecretHashBcrypt or SecretHashPBKDF2).
+//
+// The hash can be used as the secret of a Client instead of the secret itself,
+// so the secrets do not need to be kept in plain text.
+// The Argon2id and PBKDF2 hashes use the PHC string format, with the salt
+// and the hash encoded in unpadded standard base64.
+func HashSecret(secret, algorithm string) (string, error) {
+	salt := make([]byte, saltLength)
+	rand.Read(salt)
+	b64 := base64.RawStdEncoding
+
+	switch algorithm {
+	case SecretHashArgon2id:
+		key := argon2.IDKey([]byte(secret), salt, argon2Time, argon2Memory, argon2Threads, keyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+			argon2Memory, argon2Time, argon2Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case SecretHashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		return string(hash), err
+	case SecretHashPBKDF2:
+		key, err := pbkdf2.Key(sha256.New, secret, salt, pbkdf2Iter, keyLength)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$pbkdf2-sha256$i=%d$%s$%s", pbkdf2Iter,
+			b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("unknown hash algorithm %q", algorithm)
+}
+
+// verifySecret checks in constant time if a secret sent by a client matches
+// the one stored in the server, which can be a hash made with HashSecret
+// or the secret itself.
+func verifySecret(stored, secret string) bool {
+	if stored == "" {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return verifyArgon2id(stored, secret)
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(secret)) == nil
+	case strings.HasPrefix(stored, "$pbkdf2-sha256$"):
+		return verifyPBKDF2(stored, secret)
+	}
+
+	// Comparing the digests hides the length of the stored secret.
+	a := sha256.Sum256([]byte(stored))
+	b := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// parseHash splits a hash in the PHC string format, returning its parameters,
+// its salt and its hash.
+func parseHash(stored string, nfields int) (params []string, salt, key []byte, err error) {
+	fields := strings.Split(stored, "$")
+	if len(fields) != nfields {
+		return nil, nil, nil, fmt.Errorf("invalid hash")
+	}
+	b64 := base64.RawStdEncoding
+	if salt, err = b64.DecodeString(fields[nfields-2]); err != nil {
+		return nil, nil, nil, err
+	}
+	if key, err = b64.DecodeString(fields[nfields-1]); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(key) == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid hash")
+	}
+	return fields[2 : nfields-2], salt, key, nil
+}
+
+func verifyArgon2id(stored, secret string) bool {
+	params, salt, key, err := parseHash(stored, 6)
+	if err != nil {
+		return false
+	}
+	var version int
+	var memory, passes uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(params[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	if _, err := fmt.Sscanf(params[1], "m=%d,t=%d,p=%d", &memory, &passes, &threads); err != nil || passes == 0 || threads == 0 {
+		return false
+	}
+	computed := argon2.IDKey([]byte(secret), salt, passes, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func verifyPBKDF2(stored, secret string) bool {
+	params, salt, key, err := parseHash(stored, 5)
+	if err != nil {
+		return false
+	}
+	var iter int
+	if _, err := fmt.Sscanf(params[0], "i=%d", &iter); err != nil {
+		return false
+	}
+	// A shorter key would be a prefix of the computed one, so a truncated hash
+	// would still match (unlike Argon2id, where the length changes the whole hash).
+	if len(key) != sha256.Size {
+		return false
+	}
+	computed, err := pbkdf2.Key(sha256.New, secret, salt, iter, len(key))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
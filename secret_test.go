@@ -0,0 +1,255 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+// authenticates reports whether ts accepts a client ID and a secret,
+// sending them to the introspection endpoint.
+func authenticates(t *testing.T, ts *httptest.Server, clientID, secret string) bool {
+	t.Helper()
+	resp, err := ts.Client().PostForm(ts.URL+"/oidc/introspect", url.Values{
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"token":         {"token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+	return resp.StatusCode == http.StatusOK
+}
+
+func TestHashSecret(t *testing.T) {
+	s, ts := newTestServer(t)
+	prefixes := map[string]string{
+		jambo.SecretHashArgon2id: "$argon2id$v=19$",
+		jambo.SecretHashBcrypt:   "$2a$",
+		jambo.SecretHashPBKDF2:   "$pbkdf2-sha256$i=",
+	}
+	for algorithm, prefix := range prefixes {
+		hash, err := jambo.HashSecret("my-secret", algorithm)
+		if err != nil {
+			t.Fatalf("HashSecret(%s): %v", algorithm, err)
+		}
+		if !strings.HasPrefix(hash, prefix) {
+			t.Errorf("HashSecret(%s) = %q; want prefix %q", algorithm, hash, prefix)
+		}
+		if again, _ := jambo.HashSecret("my-secret", algorithm); again == hash {
+			t.Errorf("HashSecret(%s) returned the same hash twice; want a random salt", algorithm)
+		}
+		s.NewClient(algorithm, hash)
+		if !authenticates(t, ts, algorithm, "my-secret") {
+			t.Errorf("%s: the secret is not accepted", algorithm)
+		}
+		for _, wrong := range []string{"other-secret", "my-secret ", "", hash} {
+			if authenticates(t, ts, algorithm, wrong) {
+				t.Errorf("%s: secret %q accepted; want it rejected", algorithm, wrong)
+			}
+		}
+	}
+	if _, err := jambo.HashSecret("my-secret", "md5"); err == nil {
+		t.Error("HashSecret with an unknown algorithm succeeded; want an error")
+	}
+}
+
+func TestMalformedSecretHash(t *testing.T) {
+	s, ts := newTestServer(t)
+	argon2id, _ := jambo.HashSecret("my-secret", jambo.SecretHashArgon2id)
+	pbkdf2, _ := jambo.HashSecret("my-secret", jambo.SecretHashPBKDF2)
+	bcrypt, _ := jambo.HashSecret("my-secret", jambo.SecretHashBcrypt)
+	dropLast := func(hash string) string {
+		return hash[:strings.LastIndex(hash, "$")]
+	}
+	replaceField := func(hash string, i int, value string) string {
+		fields := strings.Split(hash, "$")
+		fields[i] = value
+		return strings.Join(fields, "$")
+	}
+
+	tests := map[string]string{
+		"argon2id without hash":      dropLast(argon2id),
+		"argon2id with empty hash":   dropLast(argon2id) + "$",
+		"argon2id truncated hash":    argon2id[:len(argon2id)-4],
+		"argon2id bad base64 salt":   replaceField(argon2id, 4, "!!!!"),
+		"argon2id bad base64 hash":   replaceField(argon2id, 5, "!!!!"),
+		"argon2id other version":     replaceField(argon2id, 2, "v=16"),
+		"argon2id no threads":        replaceField(argon2id, 3, "m=65536,t=3,p=0"),
+		"argon2id bad parameters":    replaceField(argon2id, 3, "m=65536"),
+		"argon2id extra field":       argon2id + "$AAAA",
+		"pbkdf2 without hash":        dropLast(pbkdf2),
+		"pbkdf2 truncated hash":      pbkdf2[:len(pbkdf2)-4],
+		"pbkdf2 bad base64 salt":     replaceField(pbkdf2, 3, "!!!!"),
+		"pbkdf2 bad iterations":      replaceField(pbkdf2, 2, "i=x"),
+		"pbkdf2 no iterations":       replaceField(pbkdf2, 2, "i=0"),
+		"bcrypt truncated":           bcrypt[:len(bcrypt)-4],
+		"unknown prefix":             "$scrypt" + strings.TrimPrefix(argon2id, "$argon2id"),
+		"other pbkdf2 hash function": "$pbkdf2-sha512" + strings.TrimPrefix(pbkdf2, "$pbkdf2-sha256"),
+	}
+	for name, stored := range tests {
+		s.NewClient(name, stored)
+		if authenticates(t, ts, name, "my-secret") {
+			t.Errorf("%s (%q): secret accepted; want it rejected", name, stored)
+		}
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	var c *jambo.Client
+	s, ts := newTestServer(t, func(tc *jambo.Client) { c = tc })
+	newSecret, _ := jambo.HashSecret("new-secret", jambo.SecretHashBcrypt)
+
+	// During the grace period, both secrets are accepted.
+	c.ExpireSecrets(time.Now().Add(time.Hour))
+	c.AddSecret(newSecret, time.Time{})
+	for _, secret := range []string{testClientSecret, "new-secret"} {
+		if !authenticates(t, ts, testClientID, secret) {
+			t.Errorf("secret %q rejected during the grace period; want it accepted", secret)
+		}
+	}
+	for i, cs := range s.ClientSecrets(c) {
+		if cs.LastUsed.IsZero() {
+			t.Errorf("secret %d has no LastUsed time; want the time it was used", i)
+		}
+	}
+
+	// Once the old one expires, only the new one is accepted (ExpireSecrets
+	// affects every secret, so the new one is added again after it).
+	c.ExpireSecrets(time.Now().Add(-time.Second))
+	c.AddSecret(newSecret, time.Time{})
+	if authenticates(t, ts, testClientID, testClientSecret) {
+		t.Error("expired secret accepted; want it rejected")
+	}
+	if !authenticates(t, ts, testClientID, "new-secret") {
+		t.Error("new secret rejected after the old one expired; want it accepted")
+	}
+	c.RemoveExpiredSecrets()
+	if secrets := s.ClientSecrets(c); len(secrets) != 1 || secrets[0].Secret != newSecret {
+		t.Errorf("secrets after RemoveExpiredSecrets: %v; want only the new one", secrets)
+	}
+	if authenticates(t, ts, testClientID, testClientSecret) {
+		t.Error("removed secret accepted; want it rejected")
+	}
+}
+
+func TestSecretLastUsed(t *testing.T) {
+	storage := jambo.NewMemoryStorage()
+	var c1, c2 *jambo.Client
+	s1, ts1 := newTestServer(t, func(c *jambo.Client) { c1 = c })
+	s2, _ := newTestServer(t, func(c *jambo.Client) { c2 = c })
+	s1.SetStorage(storage)
+	s2.SetStorage(storage)
+	for _, c := range []*jambo.Client{c1, c2} {
+		c.AddSecret("unused-secret", time.Time{})
+	}
+
+	start := time.Now().Truncate(time.Second)
+	if !authenticates(t, ts1, testClientID, testClientSecret) {
+		t.Fatal("secret rejected")
+	}
+	// The last use is kept in the Storage, so every server sharing it knows it.
+	for i, secrets := range [][]jambo.ClientSecret{s1.ClientSecrets(c1), s2.ClientSecrets(c2)} {
+		if len(secrets) != 2 || secrets[0].LastUsed.Before(start) || secrets[0].LastUsed.After(time.Now()) {
+			t.Errorf("server %d: secrets %v; want the first one used now", i+1, secrets)
+		} else if !secrets[1].LastUsed.IsZero() {
+			t.Errorf("server %d: unused secret has LastUsed %v; want none", i+1, secrets[1].LastUsed)
+		}
+	}
+}
+
+func TestClientSecretsJSON(t *testing.T) {
+	s, _ := newTestServer(t)
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	tests := []struct {
+		name      string
+		configure func(c *jambo.Client)
+		want      string
+	}{
+		{"one secret", func(c *jambo.Client) {}, `"client_secret":"secret"`},
+		{"expiring secret", func(c *jambo.Client) { c.ExpireSecrets(notAfter) },
+			`"client_secrets":[{"secret":"secret","not_after":"` + notAfter.Format(time.RFC3339) + `"}]`},
+		{"several secrets", func(c *jambo.Client) { c.AddSecret("new-secret", time.Time{}) },
+			`"client_secrets":[{"secret":"secret"},{"secret":"new-secret"}]`},
+	}
+	for _, test := range tests {
+		c := s.NewClient("json-client", testClientSecret)
+		test.configure(c)
+		data, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), test.want) {
+			t.Errorf("%s: client encoded as %s; want it to contain %s", test.name, data, test.want)
+		}
+		var loaded jambo.Client
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			t.Fatal(err)
+		}
+		got, want := s.ClientSecrets(&loaded), s.ClientSecrets(c)
+		if len(got) != len(want) {
+			t.Errorf("%s: reloaded client has secrets %v; want %v", test.name, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i].Secret != want[i].Secret || !got[i].NotAfter.Equal(want[i].NotAfter) {
+				t.Errorf("%s: reloaded client has secrets %v; want %v", test.name, got, want)
+			}
+		}
+	}
+
+	// Both fields can be used at the same time.
+	var loaded jambo.Client
+	err := json.Unmarshal([]byte(`{"client_id":"json-client","client_secret":"one","client_secrets":[{"secret":"two"}]}`), &loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets := s.ClientSecrets(&loaded); len(secrets) != 2 || secrets[0].Secret != "one" || secrets[1].Secret != "two" {
+		t.Errorf("client with client_secret and client_secrets has secrets %v; want one and two", secrets)
+	}
+}
+
+func TestRegisteredSecretExpiration(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetOpenRegistration(true)
+
+	status, resp := register(t, ts.URL, map[string]any{"redirect_uris": []string{"https://app.example/cb"}})
+	if status != http.StatusCreated || resp["client_secret_expires_at"] != float64(0) {
+		t.Errorf("registration without secret lifetime: status %d, client_secret_expires_at %v; want 0", status, resp["client_secret_expires_at"])
+	}
+
+	s.SetRegisteredSecretLifetime(time.Hour)
+	earliest := time.Now().Add(time.Hour).Unix()
+	status, resp = register(t, ts.URL, map[string]any{"redirect_uris": []string{"https://app.example/cb"}})
+	expiresAt, _ := resp["client_secret_expires_at"].(float64)
+	if status != http.StatusCreated || expiresAt < float64(earliest) || expiresAt > float64(time.Now().Add(time.Hour).Unix()) {
+		t.Fatalf("registration with secret lifetime: status %d, client_secret_expires_at %v; want in an hour", status, resp["client_secret_expires_at"])
+	}
+	clientID, _ := resp["client_id"].(string)
+	secret, _ := resp["client_secret"].(string)
+	if !authenticates(t, ts, clientID, secret) {
+		t.Error("registered secret rejected before it expires")
+	}
+
+	// The registration endpoint of the client sends the same expiration time.
+	req, _ := http.NewRequest(http.MethodGet, resp["registration_client_uri"].(string), nil)
+	req.Header.Set("Authorization", "Bearer "+resp["registration_access_token"].(string))
+	r, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read map[string]any
+	json.Unmarshal([]byte(readBody(t, r)), &read)
+	if r.StatusCode != http.StatusOK || read["client_secret_expires_at"] != expiresAt || read["client_secret"] != secret {
+		t.Errorf("reading the registration: status %d, client_secret_expires_at %v; want %v and the same secret",
+			r.StatusCode, read["client_secret_expires_at"], expiresAt)
+	}
+}
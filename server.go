@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"embed"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -16,6 +18,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cespedes/jambo/mergefs"
 	"github.com/go-jose/go-jose/v4"
@@ -30,21 +33,59 @@ var _webStatic embed.FS
 var _webTemplates embed.FS
 
 type Client struct {
-	id                  string
-	secret              string
-	allowedRedirectURIs []string
-	allowedScopes       []string // allowed extra scopes
-	allowedRoles        []string // if empty, any user is allowed
+	id                            string
+	secrets                       []ClientSecret // accepted secrets, oldest first
+	name                          string
+	tokenEndpointAuthMethod       string
+	registrationAccessToken       string // SHA-256 hash of the token, for registered clients
+	allowedRedirectURIs           []string
+	allowedPostLogoutRedirectURIs []string
+	allowedScopes                 []string           // allowed extra scopes
+	allowedRoles                  []string           // if empty, any user is allowed
+	requireConsent                bool               // users must approve every authorization request
+	defaultACRValues              []string           // used if the client does not send "acr_values"
+	minimumACR                    string             // if not empty, weaker authentications are rejected
+	backchannelLogoutURI          string             // where to send logout tokens
+	frontchannelLogoutURI         string             // page to load in the browser on logout
+	jwks                          jose.JSONWebKeySet // public keys of the client, for private_key_jwt
+	jwksURI                       string             // where to get the public keys of the client
+	tlsClientAuthSubjectDN        string             // subject of the certificate, for tls_client_auth
+	tlsClientAuthSANDNS           string             // DNS name in the certificate, for tls_client_auth
+	tlsClientCertThumbprints      []string           // self-signed certificates, for self_signed_tls_client_auth
+	certificateBoundAccessTokens  bool               // access tokens are bound to the client certificate
+	dpopBoundAccessTokens         bool               // access tokens must be bound to a DPoP key
+	requirePAR                    bool               // authorization requests must be sent to "/par"
+	requestURIs                   []string           // where to get the request objects of the client
+	requireSignedRequestObject    bool               // authorization requests must be in a request object
+	authorizationResponseAlg      string             // algorithm used to sign the JARM responses
+	responseTypes                 []string           // allowed response types, besides "code"
+
+	// Scopes of the API resources granted to the client, by identifier:
+	apiResources map[string][]string
 }
 
 type Connection struct {
-	code        string
-	client      *Client
-	redirectURI string
-	state       string
-	nonce       string
-	scopes      []string
-	response    Response // last response from the authenticator
+	code         string
+	client       *Client
+	redirectURI  string
+	state        string
+	nonce        string
+	scopes       []string
+	claims       *ClaimsRequest // "claims" request parameter, if any
+	prompt       []string       // "prompt" request parameter
+	maxAge       int            // "max_age" request parameter, or -1 if not present
+	acrValues    []string       // requested Authentication Context Class References
+	loginHint    string         // "login_hint" request parameter, or subject of "id_token_hint"
+	idTokenHint  string         // subject of the "id_token_hint" request parameter
+	response     Response       // last response from the authenticator
+	authTime     time.Time      // time of the last successful authentication
+	sid          string         // ID of the browser session
+	consented    bool           // the user has approved this request
+	authorized   bool           // the code has been sent to the client
+	dpopJKT      string         // thumbprint of the DPoP key the refresh tokens are bound to
+	responseType string         // normalized "response_type" parameter
+	responseMode string         // how to send the authorization response
+	resources    []string       // requested protected resources ("resource" parameters)
 }
 
 type Server struct {
@@ -60,13 +101,32 @@ type Server struct {
 
 	templateArgs map[string]string
 
+	acrValues []string // supported ACR values, from weakest to strongest
+
 	mux     *http.ServeMux
 	key     jose.JSONWebKey
+	encKey  jose.JSONWebKey // used by the clients to encrypt request objects
 	allKeys jose.JSONWebKeySet
 
-	sync.Mutex  // to access clients and connections
-	clients     []*Client
-	connections map[string]Connection
+	sessionIdleTimeout time.Duration
+	sessionMaxLifetime time.Duration
+
+	clients    ClientStore
+	storage    Storage
+	httpClient *http.Client   // used to connect to the clients
+	clientCAs  *x509.CertPool // used to verify the client certificates
+
+	openRegistration         bool          // anyone can register new clients
+	initialAccessTokens      []string      // tokens allowed to register new clients
+	registeredSecretLifetime time.Duration // if not zero, secrets of registered clients expire
+
+	dpopNonceRequired bool // DPoP proofs must have a nonce issued by the server
+
+	resources []APIResource // protected resources, for the "resource" parameter
+
+	sync.Mutex       // to modify sessions and access logout deliveries and cached keys
+	logoutDeliveries []LogoutDelivery
+	jwksCache        map[string]cachedJWKS // keys fetched from the "jwks_uri" of the clients
 }
 
 func NewServer(issuer, root string) *Server {
@@ -121,7 +181,12 @@ func NewServer(issuer, root string) *Server {
 
 	s.routes()
 
-	s.connections = make(map[string]Connection)
+	s.clients = NewMemoryClientStore()
+	s.storage = NewMemoryStorage()
+	s.jwksCache = make(map[string]cachedJWKS)
+	s.sessionIdleTimeout = 1 * time.Hour
+	s.sessionMaxLifetime = 12 * time.Hour
+	s.httpClient = &http.Client{Timeout: 10 * time.Second}
 
 	// fmt.Printf("Server ready at %s (root path is %s).\n", issuer, root)
 	return &s
@@ -132,9 +197,16 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("/.well-known/openid-configuration", s.openIDConfiguration)
 	s.mux.HandleFunc("/auth", s.openIDAuth)
 	s.mux.HandleFunc("/auth/login", s.authLogin)
+	s.mux.HandleFunc("/auth/consent", s.authConsent)
+	s.mux.HandleFunc("POST /par", s.openIDPushedAuth)
 	s.mux.HandleFunc("/token", s.openIDToken)
+	s.mux.HandleFunc("POST /revoke", s.openIDRevoke)
+	s.mux.HandleFunc("POST /introspect", s.openIDIntrospect)
 	s.mux.HandleFunc("/userinfo", s.userinfo)
 	s.mux.HandleFunc("/keys", s.openIDKeys)
+	s.mux.HandleFunc("/logout", s.openIDEndSession)
+	s.mux.HandleFunc("POST /register", s.openIDRegister)
+	s.mux.HandleFunc("/register/{client_id}", s.openIDRegistration)
 
 	// All the files and dirs inside s.webStatic will be served as-is:
 	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -237,12 +309,28 @@ func (s *Server) createKey() error {
 		Use:       "sig",
 	}
 
+	encKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+	s.encKey = jose.JSONWebKey{
+		Key:       encKey,
+		KeyID:     keyID + "-enc",
+		Algorithm: string(jose.RSA_OAEP_256),
+		Use:       "enc",
+	}
+
 	s.allKeys = jose.JSONWebKeySet{
 		Keys: []jose.JSONWebKey{{
 			Key:       key.Public(),
 			KeyID:     keyID,
 			Algorithm: "RS256",
 			Use:       "sig",
+		}, {
+			Key:       encKey.Public(),
+			KeyID:     s.encKey.KeyID,
+			Algorithm: s.encKey.Algorithm,
+			Use:       "enc",
 		}},
 	}
 	return nil
@@ -265,12 +353,49 @@ func (s *Server) GetConnection(r *http.Request) *Connection {
 	return c
 }
 
+// NewClient creates a new client and adds it to the client store.
+// The secret can be given in plain text or as a hash made with [HashSecret].
+// If the store does not keep the clients in memory, the client must be saved
+// with [Server.SaveClient] once it is configured.
+//
+// If the store already has a client with the same ID (for example, one kept in a file
+// or a database by a previous run of the program), the store is not modified: the
+// returned client is a new one, which only replaces the stored one when it is saved
+// with [Server.SaveClient].
 func (s *Server) NewClient(name, secret string) *Client {
 	c := &Client{
-		id:     name,
-		secret: secret,
+		id: name,
+	}
+	if secret != "" {
+		c.AddSecret(secret, time.Time{})
+	}
+	if _, err := s.clients.Client(name); errors.Is(err, ErrClientNotFound) {
+		if err := s.clients.CreateClient(c); err != nil {
+			log.Printf("NewClient(%q): %v\n", name, err)
+		}
+	}
+	return c
+}
+
+// SaveClient saves a client in the client store, replacing the one with the same ID
+// or adding it if there is none.
+func (s *Server) SaveClient(c *Client) error {
+	err := s.clients.UpdateClient(c)
+	if errors.Is(err, ErrClientNotFound) {
+		err = s.clients.CreateClient(c)
+	}
+	return err
+}
+
+// findClient returns the client with a given ID, or nil if it does not exist.
+func (s *Server) findClient(id string) *Client {
+	c, err := s.clients.Client(id)
+	if err != nil {
+		if _DEBUG && !errors.Is(err, ErrClientNotFound) {
+			log.Printf("client %q: %v\n", id, err)
+		}
+		return nil
 	}
-	s.clients = append(s.clients, c)
 	return c
 }
 
@@ -278,10 +403,36 @@ func (c *Client) AddAllowedRedirectURIs(names ...string) {
 	c.allowedRedirectURIs = append(c.allowedRedirectURIs, names...)
 }
 
+// AddAllowedPostLogoutRedirectURIs adds one or more URIs to the list of
+// the allowed addresses to redirect the user after logging out.
+func (c *Client) AddAllowedPostLogoutRedirectURIs(names ...string) {
+	c.allowedPostLogoutRedirectURIs = append(c.allowedPostLogoutRedirectURIs, names...)
+}
+
 func (c *Client) AddAllowedScopes(names ...string) {
 	c.allowedScopes = append(c.allowedScopes, names...)
 }
 
+// SetRequireConsent specifies whether the users must explicitly approve
+// every authorization request from this client.  If not, they will only
+// be asked when the client sends the "consent" prompt.
+func (c *Client) SetRequireConsent(require bool) {
+	c.requireConsent = require
+}
+
+// SetDefaultACRValues sets the Authentication Context Class Reference values
+// requested to the authenticator when the client does not send "acr_values".
+func (c *Client) SetDefaultACRValues(values ...string) {
+	c.defaultACRValues = values
+}
+
+// SetMinimumACR sets the weakest Authentication Context Class Reference
+// accepted for this client.  Authentications with a weaker ACR (as ordered
+// by [Server.SetACRValues]) will be rejected.
+func (c *Client) SetMinimumACR(acr string) {
+	c.minimumACR = acr
+}
+
 // AddAllowedRoles adds one or more roles to the list of the
 // allowed roles for users.  If there are no allowed roles, any user
 // can log in.  If there is at least one, the users must belong to one
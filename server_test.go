@@ -0,0 +1,282 @@
+package jambo_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cespedes/jambo"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// Settings of the client created by newTestServer:
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testRedirectURI  = "https://client.example/cb"
+	testPassword     = "password"
+)
+
+// newTestServer returns a Server for the tests, and the httptest.Server which serves it.
+// It has a client testClientID, which is passed to the configure functions, and its
+// authenticator accepts any user with testPassword.
+func newTestServer(t *testing.T, configure ...func(*jambo.Client)) (*jambo.Server, *httptest.Server) {
+	t.Helper()
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return setupTestServer(ts, mux, configure...), ts
+}
+
+// setupTestServer creates the Server for newTestServer, served by ts through mux.
+// The clients are kept in memory, so the test client can be modified later.
+func setupTestServer(ts *httptest.Server, mux *http.ServeMux, configure ...func(*jambo.Client)) *jambo.Server {
+	s := jambo.NewServer(ts.URL+"/oidc", "/oidc")
+	mux.Handle("/oidc/", s)
+	c := s.NewClient(testClientID, testClientSecret)
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	for _, f := range configure {
+		f(c)
+	}
+	s.SetAuthenticator(func(req *jambo.Request) jambo.Response {
+		if req.Params["password"] != testPassword {
+			return jambo.Response{Type: jambo.ResponseTypeLoginFailed, Login: req.Params["login"]}
+		}
+		return jambo.Response{
+			Type:  jambo.ResponseTypeLoginOK,
+			Login: req.Params["login"],
+			Name:  "Test User",
+			Mail:  req.Params["login"] + "@example.com",
+		}
+	})
+	return s
+}
+
+// newBrowser returns an HTTP client with cookies, which does not follow redirects.
+func newBrowser(ts *httptest.Server) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar:       jar,
+		Transport: ts.Client().Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// authParams returns the parameters of an authorization request from the test client,
+// with the values in extra.
+func authParams(extra url.Values) url.Values {
+	params := url.Values{
+		"client_id":     {testClientID},
+		"redirect_uri":  {testRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid profile email"},
+		"state":         {"state"},
+	}
+	for key, values := range extra {
+		params[key] = values
+	}
+	return params
+}
+
+var sessionRE = regexp.MustCompile(`name="session" value="([^"]*)"`)
+
+// login sends an authorization request, and logs in as a user in the login page.
+// It returns the response to the login form.
+func login(t *testing.T, browser *http.Client, ts *httptest.Server, params url.Values, user string) *http.Response {
+	t.Helper()
+	resp, err := browser.Get(ts.URL + "/oidc/auth?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readBody(t, resp)
+	m := sessionRE.FindStringSubmatch(page)
+	if m == nil {
+		t.Fatalf("no login form in authorization response (%s):\n%s", resp.Status, page)
+	}
+	resp, err = browser.PostForm(ts.URL+"/oidc/auth/login", url.Values{
+		"session":  {m[1]},
+		"login":    {user},
+		"password": {testPassword},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// authorize sends an authorization request and, if the server shows the login form,
+// logs in as alice.  It returns where the browser is redirected to, or, if it is
+// not redirected, nil and the page shown by the server.
+func authorize(t *testing.T, browser *http.Client, ts *httptest.Server, params url.Values) (*url.URL, string) {
+	t.Helper()
+	resp, err := browser.Get(ts.URL + "/oidc/auth?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readBody(t, resp)
+	if m := sessionRE.FindStringSubmatch(page); m != nil {
+		resp, err = browser.PostForm(ts.URL+"/oidc/auth/login", url.Values{
+			"session":  {m[1]},
+			"login":    {"alice"},
+			"password": {testPassword},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		page = readBody(t, resp)
+	}
+	if resp.StatusCode != http.StatusFound && resp.StatusCode != http.StatusSeeOther {
+		return nil, page
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location, ""
+}
+
+// authCode runs an authorization request and returns the code sent to the client.
+func authCode(t *testing.T, browser *http.Client, ts *httptest.Server, params url.Values) string {
+	t.Helper()
+	resp := login(t, browser, ts, params, "alice")
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in authorization response (%s): %s", resp.Status, location)
+	}
+	return code
+}
+
+// postForm sends a POST request authenticated as the test client, and returns
+// the status code and the decoded JSON response.
+func postForm(t *testing.T, ts *httptest.Server, path string, params url.Values) (int, map[string]any) {
+	t.Helper()
+	params.Set("client_id", testClientID)
+	params.Set("client_secret", testClientSecret)
+	resp, err := ts.Client().PostForm(ts.URL+"/oidc"+path, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &body)
+	return resp.StatusCode, body
+}
+
+// getTokens runs the authorization code flow with some parameters and returns
+// the response of the token endpoint.
+func getTokens(t *testing.T, ts *httptest.Server, params url.Values) map[string]any {
+	t.Helper()
+	code := authCode(t, newBrowser(ts), ts, params)
+	status, tokens := postForm(t, ts, "/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {testRedirectURI},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token endpoint: status %d: %v", status, tokens)
+	}
+	return tokens
+}
+
+// getUserInfo calls the userinfo endpoint with an access token.
+func getUserInfo(t *testing.T, ts *httptest.Server, accessToken string) map[string]any {
+	t.Helper()
+	req, _ := http.NewRequest("GET", ts.URL+"/oidc/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &claims)
+	return claims
+}
+
+// jwtClaims returns the claims of a JWT, without checking its signature.
+func jwtClaims(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("%q is not a JWS", token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// serverKeys returns the keys published by ts.
+func serverKeys(t *testing.T, ts *httptest.Server) jose.JSONWebKeySet {
+	t.Helper()
+	resp, err := ts.Client().Get(ts.URL + "/oidc/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal([]byte(readBody(t, resp)), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	return jwks
+}
+
+// newClientKey returns a new signing key for a client, and a JWK Set with its public key.
+func newClientKey(t *testing.T, kid string) (jose.JSONWebKey, jose.JSONWebKeySet) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: kid, Algorithm: string(jose.ES256), Use: "sig"}
+	return jwk, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}}
+}
+
+// signJWT returns a JWT with some claims signed with a key, and with a "typ" header
+// if typ is not empty.
+func signJWT(t *testing.T, key jose.JSONWebKey, typ string, claims any) string {
+	t.Helper()
+	opts := &jose.SignerOptions{}
+	if typ != "" {
+		opts.WithType(jose.ContentType(typ))
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
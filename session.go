@@ -0,0 +1,282 @@
+package jambo
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie      = "jambo_session"       // cookie used to keep the browser session
+	browserStateCookie = "jambo_browser_state" // cookie used by the check_session_iframe
+)
+
+// An ssoSession is a browser session, shared by all the clients.
+// It lets a user already authenticated in one client log in to
+// other clients without having to authenticate again.
+// It is kept in the Storage as JSON.
+type ssoSession struct {
+	ID           string    `json:"id"`            // value of the session cookie
+	SID          string    `json:"sid"`           // session ID sent to the clients in the "sid" claim
+	BrowserState string    `json:"browser_state"` // opaque value used to compute the "session_state"
+	Response     Response  `json:"response"`      // last successful response from the authenticator
+	AuthTime     time.Time `json:"auth_time"`     // time of the last successful authentication
+	Created      time.Time `json:"created"`
+	LastUsed     time.Time `json:"last_used"`
+
+	AuthenticatedClients []string            `json:"authenticated_clients,omitempty"` // clients for which the authenticator accepted the user
+	Clients              []string            `json:"clients,omitempty"`               // clients that have received tokens in this session
+	Consents             map[string][]string `json:"consents,omitempty"`              // scopes approved by the user, by client
+}
+
+// SetSessionTimeouts sets the maximum time of inactivity and the maximum
+// lifetime of the browser sessions.
+func (s *Server) SetSessionTimeouts(idle, absolute time.Duration) {
+	s.sessionIdleTimeout = idle
+	s.sessionMaxLifetime = absolute
+}
+
+// sessionExpiration returns the time when a browser session will expire, if it is not used again.
+func (s *Server) sessionExpiration(sess *ssoSession) time.Time {
+	idle := sess.LastUsed.Add(s.sessionIdleTimeout)
+	absolute := sess.Created.Add(s.sessionMaxLifetime)
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// saveSession stores a browser session in the Storage.
+func (s *Server) saveSession(sess *ssoSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	expires := s.sessionExpiration(sess)
+	if err := s.storage.Put(bucketSessions, sess.ID, data, expires); err != nil {
+		return err
+	}
+	return s.storage.Put(bucketSessionIDs, sess.SID, []byte(sess.ID), expires)
+}
+
+// loadSession returns the browser session with a given cookie value, or nil if it does not exist.
+func (s *Server) loadSession(id string) *ssoSession {
+	data, err := s.storage.Get(bucketSessions, id)
+	if err != nil {
+		return nil
+	}
+	var sess ssoSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil
+	}
+	return &sess
+}
+
+// deleteSession removes a browser session from the Storage.
+func (s *Server) deleteSession(sess *ssoSession) {
+	s.storage.Delete(bucketSessions, sess.ID)
+	s.storage.Delete(bucketSessionIDs, sess.SID)
+}
+
+// updateSession modifies the browser session with a given sid, if it exists.
+func (s *Server) updateSession(sid string, f func(sess *ssoSession)) {
+	s.Lock()
+	defer s.Unlock()
+
+	sess := s.findSession(sid)
+	if sess == nil {
+		return
+	}
+	f(sess)
+	s.saveSession(sess)
+}
+
+// cookieSession returns the browser session whose cookie is sent in a request,
+// or nil if there is none or it has expired.
+func (s *Server) cookieSession(r *http.Request) *ssoSession {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	return s.loadSession(cookie.Value)
+}
+
+// getSession returns the browser session of a request, or nil if there is none
+// or it has expired, and records that it has been used.
+// The cookies are sent again, so they expire with the session; if the session
+// no longer exists (because it has expired or it has been terminated by the server),
+// they are removed, so the check_session_iframe sees that it has changed.
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) *ssoSession {
+	sess := s.cookieSession(r)
+	if sess == nil {
+		if _, err := r.Cookie(sessionCookie); err == nil {
+			s.clearSessionCookies(w)
+		}
+		return nil
+	}
+	sess.LastUsed = time.Now()
+	s.saveSession(sess)
+	s.setSessionCookies(w, sess)
+	return sess
+}
+
+// startSession creates a new browser session for a user that has just been
+// authenticated, replacing the previous one (if any), and sends its cookie.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, conn *Connection) *ssoSession {
+	now := time.Now()
+	sess := &ssoSession{
+		ID:           rand.Text(),
+		SID:          rand.Text(),
+		BrowserState: rand.Text(),
+		Response:     conn.response,
+		AuthTime:     conn.authTime,
+		Created:      now,
+		LastUsed:     now,
+	}
+
+	if old := s.cookieSession(r); old != nil {
+		// If the same user authenticates again, the consents are kept:
+		if old.Response.Login == conn.response.Login {
+			sess.AuthenticatedClients = old.AuthenticatedClients
+			sess.Consents = old.Consents
+		}
+		s.deleteSession(old)
+	}
+	sess.AuthenticatedClients = append(sess.AuthenticatedClients, conn.client.id)
+
+	s.saveSession(sess)
+	s.setSessionCookies(w, sess)
+	return sess
+}
+
+// setSessionCookies sends the cookies of a browser session: the session cookie itself,
+// and the browser state cookie, which can be read by the check_session_iframe.
+// Both of them expire when the session does, if it is not used again.
+func (s *Server) setSessionCookies(w http.ResponseWriter, sess *ssoSession) {
+	secure := !strings.HasPrefix(s.issuer, "http://")
+	maxAge := max(int(time.Until(s.sessionExpiration(sess)).Seconds()), 1)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sess.ID,
+		Path:     s.cookiePath(),
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// The browser state cookie is read from an iframe embedded in the clients,
+	// so it must be available in third-party contexts.
+	sameSite := http.SameSiteNoneMode
+	if !secure {
+		sameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     browserStateCookie,
+		Value:    sess.BrowserState,
+		Path:     s.cookiePath(),
+		MaxAge:   maxAge,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+}
+
+// clearSessionCookies removes the cookies of a browser session.
+func (s *Server) clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{sessionCookie, browserStateCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Path:   s.cookiePath(),
+			MaxAge: -1,
+		})
+	}
+}
+
+func (s *Server) cookiePath() string {
+	if s.root == "" {
+		return "/"
+	}
+	return s.root
+}
+
+// sessionUsable reports whether the user authenticated in a browser session
+// can be considered authenticated for a new authorization request.
+func (s *Server) sessionUsable(sess *ssoSession, conn *Connection) bool {
+	if slices.Contains(conn.prompt, promptLogin) {
+		return false
+	}
+	if conn.maxAge >= 0 && time.Since(sess.AuthTime) > time.Duration(conn.maxAge)*time.Second {
+		return false
+	}
+	if !s.acrAccepted(conn, sess.Response.ACR) {
+		// step-up authentication
+		return false
+	}
+	if conn.idTokenHint != "" && conn.idTokenHint != sess.Response.Login {
+		return false
+	}
+	if !conn.subjectMatches(sess.Response.Login) {
+		return false
+	}
+
+	// If the client restricts the allowed roles, the authenticator must have
+	// checked this user for this client.
+	if len(conn.client.allowedRoles) > 0 && !slices.Contains(sess.AuthenticatedClients, conn.client.id) {
+		return false
+	}
+	return true
+}
+
+// hasConsent reports whether the user has already approved all the scopes
+// requested by a client.
+func (s *Server) hasConsent(sess *ssoSession, conn *Connection) bool {
+	approved, ok := sess.Consents[conn.client.id]
+	if !ok {
+		return false
+	}
+	for _, scope := range conn.scopes {
+		if !slices.Contains(approved, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// addConsent records in the browser session that the user has approved
+// the scopes requested by a client.
+func (s *Server) addConsent(conn *Connection) {
+	s.updateSession(conn.sid, func(sess *ssoSession) {
+		if sess.Consents == nil {
+			sess.Consents = make(map[string][]string)
+		}
+		for _, scope := range conn.scopes {
+			if !slices.Contains(sess.Consents[conn.client.id], scope) {
+				sess.Consents[conn.client.id] = append(sess.Consents[conn.client.id], scope)
+			}
+		}
+	})
+}
+
+// sessionAddClient records that a client has received tokens in a browser session.
+func (s *Server) sessionAddClient(sid, client string) {
+	s.updateSession(sid, func(sess *ssoSession) {
+		if !slices.Contains(sess.Clients, client) {
+			sess.Clients = append(sess.Clients, client)
+		}
+	})
+}
+
+// findSession returns the browser session with a given sid, or nil if it does not exist.
+func (s *Server) findSession(sid string) *ssoSession {
+	if sid == "" {
+		return nil
+	}
+	id, err := s.storage.Get(bucketSessionIDs, sid)
+	if err != nil {
+		return nil
+	}
+	return s.loadSession(string(id))
+}
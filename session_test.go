@@ -0,0 +1,144 @@
+package jambo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientIDToken exchanges a code sent to a client with secret testClientSecret,
+// and returns the claims of the ID token.
+func clientIDToken(t *testing.T, ts *httptest.Server, clientID string, location *url.URL) map[string]any {
+	t.Helper()
+	if location == nil || location.Query().Get("code") == "" {
+		t.Fatalf("%s: redirected to %v; want a code", clientID, location)
+	}
+	resp, err := ts.Client().PostForm(ts.URL+"/oidc/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {clientID},
+		"client_secret": {testClientSecret},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens map[string]any
+	json.Unmarshal([]byte(readBody(t, resp)), &tokens)
+	idToken, _ := tokens["id_token"].(string)
+	if resp.StatusCode != http.StatusOK || idToken == "" {
+		t.Fatalf("%s: token endpoint: status %d: %v", clientID, resp.StatusCode, tokens)
+	}
+	return jwtClaims(t, idToken)
+}
+
+func TestSingleSignOn(t *testing.T) {
+	s, ts := newTestServer(t)
+	other := s.NewClient("other-client", testClientSecret)
+	other.AddAllowedRedirectURIs(testRedirectURI)
+
+	browser := newBrowser(ts)
+	location, page := authorize(t, browser, ts, authParams(nil))
+	if location == nil {
+		t.Fatalf("login: not redirected to the client:\n%s", page)
+	}
+	first := clientIDToken(t, ts, testClientID, location)
+
+	// Another client gets a code for the same user and session without logging in.
+	location = authRedirect(t, browser, ts, authParams(url.Values{"client_id": {"other-client"}}))
+	if location == nil {
+		t.Fatal("other client: login form shown; want the session to be used")
+	}
+	second := clientIDToken(t, ts, "other-client", location)
+	if second["sub"] != "alice" || second["sid"] == nil || second["sid"] != first["sid"] || second["auth_time"] != first["auth_time"] {
+		t.Errorf("other client: ID token has sub %v, sid %v and auth_time %v; want alice, %v and %v",
+			second["sub"], second["sid"], second["auth_time"], first["sid"], first["auth_time"])
+	}
+
+	// Other browsers do not share the session.
+	if location := authRedirect(t, newBrowser(ts), ts, authParams(nil)); location != nil {
+		t.Errorf("another browser: redirected to %s; want the login form", location)
+	}
+
+	// A new login starts a new session.
+	location, page = authorize(t, browser, ts, authParams(url.Values{"prompt": {"login"}}))
+	if location == nil {
+		t.Fatalf("login again: not redirected to the client:\n%s", page)
+	}
+	if third := clientIDToken(t, ts, testClientID, location); third["sid"] == first["sid"] {
+		t.Errorf("login again: ID token has the sid of the previous session %v", third["sid"])
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetSessionTimeouts(time.Second, time.Hour)
+	browser := newBrowser(ts)
+
+	authCode(t, browser, ts, authParams(nil))
+	if location := authRedirect(t, browser, ts, authParams(nil)); location == nil {
+		t.Fatal("session just used: login form shown; want the session to be used")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if location := authRedirect(t, browser, ts, authParams(nil)); location != nil {
+		t.Errorf("session idle for longer than its timeout: redirected to %s; want the login form", location)
+	}
+}
+
+// consent answers a consent page, approving the request or not.
+func consent(t *testing.T, browser *http.Client, ts *httptest.Server, resp *http.Response, approve bool) *url.URL {
+	t.Helper()
+	page := readBody(t, resp)
+	m := sessionRE.FindStringSubmatch(page)
+	if !strings.Contains(page, `id="submit-approve"`) || m == nil {
+		t.Fatalf("status %d; want the consent page:\n%s", resp.StatusCode, page)
+	}
+	form := url.Values{"session": {m[1]}}
+	if approve {
+		form.Set("approve", "true")
+	}
+	resp, err := browser.PostForm(ts.URL+"/oidc/auth/consent", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	return location
+}
+
+func TestSessionConsents(t *testing.T) {
+	s, ts := newTestServer(t)
+	c := s.NewClient("consenting-client", testClientSecret)
+	c.AddAllowedRedirectURIs(testRedirectURI)
+	c.SetRequireConsent(true)
+	params := authParams(url.Values{"client_id": {"consenting-client"}, "scope": {"openid profile"}})
+
+	browser := newBrowser(ts)
+	if location := consent(t, browser, ts, login(t, browser, ts, params, "alice"), false); location.Query().Get("error") != "access_denied" {
+		t.Errorf("consent denied: redirected to %s; want access_denied", location)
+	}
+	location := consent(t, browser, ts, login(t, browser, ts, params, "alice"), true)
+	clientIDToken(t, ts, "consenting-client", location)
+
+	// The consent is remembered for the scopes approved, even after logging in again.
+	if location := authRedirect(t, browser, ts, params); location == nil || location.Query().Get("code") == "" {
+		t.Errorf("scopes already approved: redirected to %v; want a code", location)
+	}
+	login(t, browser, ts, authParams(url.Values{"prompt": {"login"}}), "alice").Body.Close()
+	if location := authRedirect(t, browser, ts, params); location == nil || location.Query().Get("code") == "" {
+		t.Errorf("scopes approved before logging in again: redirected to %v; want a code", location)
+	}
+
+	// Other scopes, and other users, have to be approved.
+	resp, err := browser.Get(ts.URL + "/oidc/auth?" + authParams(url.Values{"client_id": {"consenting-client"}}).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consent(t, browser, ts, resp, true)
+	resp = login(t, browser, ts, authParams(url.Values{"client_id": {"consenting-client"}, "prompt": {"login"}}), "bob")
+	consent(t, browser, ts, resp, true)
+}
@@ -0,0 +1,137 @@
+// Package sqlstore provides a [jambo.ClientStore] which keeps the clients,
+// and a [jambo.Storage] which keeps the state of the server,
+// in a SQL database, using [database/sql].
+//
+// The queries use "?" as placeholder, so they work with drivers such as
+// SQLite or MySQL.
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cespedes/jambo"
+)
+
+// DefaultClientsTable is the name of the table used by [NewClientStore].
+const DefaultClientsTable = "jambo_clients"
+
+// ClientStore is a [jambo.ClientStore] backed by a SQL table.
+// Each client is kept in a row, with its ID and its JSON encoding.
+type ClientStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewClientStore returns a ClientStore which uses the table "jambo_clients"
+// in a database, creating it if it does not exist.
+func NewClientStore(db *sql.DB) (*ClientStore, error) {
+	return NewClientStoreTable(db, DefaultClientsTable)
+}
+
+// NewClientStoreTable is like [NewClientStore], but using a given table name.
+func NewClientStoreTable(db *sql.DB, table string) (*ClientStore, error) {
+	cs := &ClientStore{db: db, table: table}
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		data TEXT NOT NULL
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("creating table %s: %w", table, err)
+	}
+	return cs, nil
+}
+
+// Client returns the client with a given ID.
+func (cs *ClientStore) Client(id string) (*jambo.Client, error) {
+	var data string
+	err := cs.db.QueryRow(fmt.Sprintf(`SELECT data FROM %s WHERE id = ?`, cs.table), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, jambo.ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c jambo.Client
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, fmt.Errorf("client %q: %w", id, err)
+	}
+	return &c, nil
+}
+
+// Clients returns all the clients in the table, sorted by ID.
+func (cs *ClientStore) Clients() ([]*jambo.Client, error) {
+	rows, err := cs.db.Query(fmt.Sprintf(`SELECT id, data FROM %s ORDER BY id`, cs.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []*jambo.Client
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		var c jambo.Client
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			return nil, fmt.Errorf("client %q: %w", id, err)
+		}
+		clients = append(clients, &c)
+	}
+	return clients, rows.Err()
+}
+
+// CreateClient inserts a new client in the table.
+func (cs *ClientStore) CreateClient(c *jambo.Client) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = cs.db.Exec(fmt.Sprintf(`INSERT INTO %s (id, data) VALUES (?, ?)`, cs.table), c.ID(), string(data))
+	return err
+}
+
+// UpdateClient replaces a client in the table.
+func (cs *ClientStore) UpdateClient(c *jambo.Client) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	res, err := cs.db.Exec(fmt.Sprintf(`UPDATE %s SET data = ? WHERE id = ?`, cs.table), string(data), c.ID())
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res); !errors.Is(err, jambo.ErrClientNotFound) {
+		return err
+	}
+	// MySQL does not count the rows where the new values are the same as the old ones.
+	var exists int
+	err = cs.db.QueryRow(fmt.Sprintf(`SELECT 1 FROM %s WHERE id = ?`, cs.table), c.ID()).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jambo.ErrClientNotFound
+	}
+	return err
+}
+
+// DeleteClient removes a client from the table.
+func (cs *ClientStore) DeleteClient(id string) error {
+	res, err := cs.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, cs.table), id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return jambo.ErrClientNotFound
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/cespedes/jambo/sqlstore"
+	"github.com/cespedes/jambo/storagetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openDB opens a new SQLite database for a test.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "jambo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestClientStore(t *testing.T) {
+	cs, err := sqlstore.NewClientStore(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storagetest.TestClientStore(cs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	st, err := sqlstore.NewStorage(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storagetest.TestStorage(st); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,166 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+// DefaultStorageTable is the name of the table used by [NewStorage].
+const DefaultStorageTable = "jambo_storage"
+
+// Storage is a [jambo.Storage] backed by a SQL table.
+// Each value is kept in a row, with its bucket, key and expiration time
+// (in nanoseconds since the Unix epoch).
+//
+// Several servers can share the same Storage, which lets them run
+// behind a load balancer.
+type Storage struct {
+	db    *sql.DB
+	table string
+}
+
+// NewStorage returns a Storage which uses the table "jambo_storage"
+// in a database, creating it if it does not exist.
+func NewStorage(db *sql.DB) (*Storage, error) {
+	return NewStorageTable(db, DefaultStorageTable)
+}
+
+// NewStorageTable is like [NewStorage], but using a given table name.
+func NewStorageTable(db *sql.DB, table string) (*Storage, error) {
+	st := &Storage{db: db, table: table}
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		bucket VARCHAR(64) NOT NULL,
+		id VARCHAR(255) NOT NULL,
+		data BLOB NOT NULL,
+		expires BIGINT NOT NULL,
+		PRIMARY KEY (bucket, id)
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("creating table %s: %w", table, err)
+	}
+	return st, nil
+}
+
+// Put stores a value, replacing the previous one (if any).
+func (st *Storage) Put(bucket, key string, value []byte, expires time.Time) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE bucket = ? AND id = ?`, st.table), bucket, key)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`INSERT INTO %s (bucket, id, data, expires) VALUES (?, ?, ?, ?)`, st.table),
+		bucket, key, nonNil(value), expires.UnixNano())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Create stores a value only if the key does not exist yet.
+// An expired value with the same key is replaced.
+func (st *Storage) Create(bucket, key string, value []byte, expires time.Time) error {
+	_, err := st.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE bucket = ? AND id = ? AND expires < ?`, st.table),
+		bucket, key, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = st.db.Exec(fmt.Sprintf(`INSERT INTO %s (bucket, id, data, expires) VALUES (?, ?, ?, ?)`, st.table),
+		bucket, key, nonNil(value), expires.UnixNano())
+	if err != nil {
+		// The error returned by a duplicate key depends on the driver,
+		// so we check if the key exists.
+		if _, err2 := st.Get(bucket, key); err2 == nil {
+			return jambo.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns a value.
+func (st *Storage) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := st.db.QueryRow(fmt.Sprintf(`SELECT data FROM %s WHERE bucket = ? AND id = ? AND expires >= ?`, st.table),
+		bucket, key, time.Now().UnixNano()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, jambo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Take returns a value and deletes it.
+// Only the caller which actually deletes the row gets the value.
+func (st *Storage) Take(bucket, key string) ([]byte, error) {
+	value, err := st.Get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE bucket = ? AND id = ? AND expires >= ?`, st.table),
+		bucket, key, time.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, jambo.ErrNotFound
+	}
+	return value, nil
+}
+
+// Delete removes a value.
+func (st *Storage) Delete(bucket, key string) error {
+	_, err := st.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE bucket = ? AND id = ?`, st.table), bucket, key)
+	return err
+}
+
+// List returns all the values in a bucket which have not expired.
+func (st *Storage) List(bucket string) (map[string][]byte, error) {
+	rows, err := st.db.Query(fmt.Sprintf(`SELECT id, data FROM %s WHERE bucket = ? AND expires >= ?`, st.table),
+		bucket, time.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// Expire removes the expired values from the table.
+// Expired values are never returned, but they are only removed
+// from the table when Expire is called.
+func (st *Storage) Expire() error {
+	_, err := st.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE expires < ?`, st.table), time.Now().UnixNano())
+	return err
+}
+
+// nonNil returns an empty slice instead of nil, which would be stored as NULL.
+func nonNil(value []byte) []byte {
+	if value == nil {
+		return []byte{}
+	}
+	return value
+}
@@ -0,0 +1,173 @@
+package jambo
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by a [Storage] when a key does not exist or has expired.
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists is returned by [Storage.Create] when a key already exists.
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// A Storage keeps the transient state of a Server: authorization codes and
+// login sessions, browser (SSO) sessions, refresh tokens and revocations.
+// Using a shared Storage, several servers can run behind a load balancer,
+// and the state survives a restart.
+//
+// Values are kept as opaque byte slices, grouped in buckets.  Every value has
+// an expiration time, after which it must not be returned.  All the methods
+// can be called concurrently.
+//
+// The package [github.com/cespedes/jambo/storagetest] can be used to check
+// that an implementation behaves as expected.
+type Storage interface {
+	// Put stores a value, replacing the previous one (if any).
+	Put(bucket, key string, value []byte, expires time.Time) error
+
+	// Create stores a value only if the key does not exist yet;
+	// otherwise it returns ErrAlreadyExists.
+	Create(bucket, key string, value []byte, expires time.Time) error
+
+	// Get returns a value, or ErrNotFound.
+	Get(bucket, key string) ([]byte, error)
+
+	// Take returns a value and deletes it, or returns ErrNotFound.
+	// If it is called concurrently with the same key, only one of the callers gets the value.
+	Take(bucket, key string) ([]byte, error)
+
+	// Delete removes a value.  Deleting a key which does not exist is not an error.
+	Delete(bucket, key string) error
+
+	// List returns all the values in a bucket, indexed by key.
+	List(bucket string) (map[string][]byte, error)
+}
+
+// Buckets used by the Server:
+const (
+	bucketConnections   = "connections"    // login sessions and authorization codes
+	bucketSessions      = "sessions"       // browser sessions, by cookie value
+	bucketSessionIDs    = "session_ids"    // cookie values of the browser sessions, by sid
+	bucketRefreshTokens = "refresh_tokens" // by SHA-256 hash of the token
+	bucketRevocations   = "revocations"    // "jti" of the revoked access tokens
+	bucketSecretUses    = "secret_uses"    // last use of each client secret
+	bucketAssertions    = "assertions"     // "jti" of the client assertions already used
+	bucketDPoPNonces    = "dpop_nonces"    // nonces issued for DPoP proofs
+	bucketDPoPProofs    = "dpop_proofs"    // "jti" of the DPoP proofs already used
+	bucketRequestURIs   = "request_uris"   // pushed authorization requests, by request_uri
+	bucketAccessTokens  = "access_tokens"  // opaque access tokens, by SHA-256 hash of the token
+)
+
+// SetStorage sets the storage used to keep the transient state of the server.
+// By default, it is kept in memory (see [NewMemoryStorage]).
+func (s *Server) SetStorage(storage Storage) {
+	s.storage = storage
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryStorage is a Storage which keeps the values in memory.
+type memoryStorage struct {
+	sync.Mutex
+	buckets map[string]map[string]memoryEntry
+}
+
+// NewMemoryStorage returns a [Storage] which keeps the values in memory.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{
+		buckets: make(map[string]map[string]memoryEntry),
+	}
+}
+
+// get returns an entry, deleting it if it has expired.  It must be called with m locked.
+func (m *memoryStorage) get(bucket, key string) ([]byte, bool) {
+	e, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(m.buckets[bucket], key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// put stores an entry.  It must be called with m locked.
+func (m *memoryStorage) put(bucket, key string, value []byte, expires time.Time) {
+	b, ok := m.buckets[bucket]
+	if !ok {
+		b = make(map[string]memoryEntry)
+		m.buckets[bucket] = b
+	}
+	b[key] = memoryEntry{value: append([]byte(nil), value...), expires: expires}
+}
+
+func (m *memoryStorage) Put(bucket, key string, value []byte, expires time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.put(bucket, key, value, expires)
+	return nil
+}
+
+func (m *memoryStorage) Create(bucket, key string, value []byte, expires time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.get(bucket, key); ok {
+		return ErrAlreadyExists
+	}
+	m.put(bucket, key, value, expires)
+	return nil
+}
+
+func (m *memoryStorage) Get(bucket, key string) ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	value, ok := m.get(bucket, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (m *memoryStorage) Take(bucket, key string) ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	value, ok := m.get(bucket, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(m.buckets[bucket], key)
+	return value, nil
+}
+
+func (m *memoryStorage) Delete(bucket, key string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+func (m *memoryStorage) List(bucket string) (map[string][]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	values := make(map[string][]byte)
+	for key := range m.buckets[bucket] {
+		if value, ok := m.get(bucket, key); ok {
+			values[key] = append([]byte(nil), value...)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package jambo_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cespedes/jambo"
+	"github.com/cespedes/jambo/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	if err := storagetest.TestStorage(jambo.NewMemoryStorage()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSharedStorage checks that several servers sharing a Storage can be used
+// interchangeably for codes, refresh tokens and their revocation.
+func TestSharedStorage(t *testing.T) {
+	storage := jambo.NewMemoryStorage()
+	s1, ts1 := newTestServer(t)
+	s2, ts2 := newTestServer(t)
+	s1.SetStorage(storage)
+	s2.SetStorage(storage)
+
+	params := authParams(url.Values{"scope": {"openid offline_access"}})
+	code := authCode(t, newBrowser(ts1), ts1, params)
+	status, tokens := postForm(t, ts2, "/token", url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {testRedirectURI},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("code from another server: status %d: %v", status, tokens)
+	}
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if refreshToken == "" {
+		t.Fatalf("no refresh token: %v", tokens)
+	}
+
+	status, tokens = postForm(t, ts1, "/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("refresh token from another server: status %d: %v", status, tokens)
+	}
+	refreshToken, _ = tokens["refresh_token"].(string)
+
+	if status, body := postForm(t, ts2, "/revoke", url.Values{"token": {refreshToken}}); status != http.StatusOK {
+		t.Fatalf("revoke: status %d: %v", status, body)
+	}
+	status, tokens = postForm(t, ts1, "/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if status != http.StatusBadRequest || tokens["error"] != "invalid_grant" {
+		t.Errorf("refresh token revoked in another server: status %d: %v; want invalid_grant", status, tokens)
+	}
+}
@@ -0,0 +1,154 @@
+package storagetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cespedes/jambo"
+)
+
+// TestClientStore tests a [jambo.ClientStore] implementation.
+// It uses clients whose IDs begin with "storagetest", which should not exist.
+// If TestClientStore finds any misbehavior, it returns an error reporting all of them.
+//
+// Typical usage inside a test is:
+//
+//	if err := storagetest.TestClientStore(cs); err != nil {
+//		t.Fatal(err)
+//	}
+func TestClientStore(cs jambo.ClientStore) error {
+	t := &clientTester{cs: cs}
+	t.testCreate()
+	t.testUpdate()
+	t.testDelete()
+	return errors.Join(t.errs...)
+}
+
+type clientTester struct {
+	cs   jambo.ClientStore
+	errs []error
+}
+
+func (t *clientTester) errorf(format string, args ...any) {
+	t.errs = append(t.errs, fmt.Errorf(format, args...))
+}
+
+// newClient returns a client decoded from its JSON metadata.
+func (t *clientTester) newClient(metadata string) *jambo.Client {
+	var c jambo.Client
+	if err := json.Unmarshal([]byte(metadata), &c); err != nil {
+		panic(err)
+	}
+	return &c
+}
+
+// checkClient checks that the store has a client with the same metadata as want,
+// or does not have it if want is nil.
+func (t *clientTester) checkClient(op, id string, want *jambo.Client) {
+	got, err := t.cs.Client(id)
+	switch {
+	case want == nil && !errors.Is(err, jambo.ErrClientNotFound):
+		t.errorf("%s: Client(%q) = %v, %v; want ErrClientNotFound", op, id, got, err)
+	case want != nil && err != nil:
+		t.errorf("%s: Client(%q): %v", op, id, err)
+	case want != nil:
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.errorf("%s: Client(%q) = %s; want %s", op, id, gotJSON, wantJSON)
+		}
+	}
+}
+
+// listed reports whether Clients returns a client with a given ID.
+func (t *clientTester) listed(op, id string) bool {
+	clients, err := t.cs.Clients()
+	if err != nil {
+		t.errorf("%s: Clients: %v", op, err)
+		return false
+	}
+	for _, c := range clients {
+		if c.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *clientTester) testCreate() {
+	const id = "storagetest-create"
+	t.checkClient("Create", id, nil)
+
+	c := t.newClient(`{
+		"client_id": "storagetest-create",
+		"client_secret": "secret",
+		"client_name": "Storage test",
+		"redirect_uris": ["https://client.example/cb"],
+		"scope": "openid profile groups",
+		"require_consent": true
+	}`)
+	if err := t.cs.CreateClient(c); err != nil {
+		t.errorf("CreateClient(%q): %v", id, err)
+		return
+	}
+	t.checkClient("Create", id, c)
+	if !t.listed("Create", id) {
+		t.errorf("Create: Clients does not return %q", id)
+	}
+	if err := t.cs.CreateClient(t.newClient(`{"client_id": "storagetest-create"}`)); err == nil {
+		t.errorf("CreateClient(%q) twice: no error", id)
+	}
+	t.checkClient("Create twice", id, c)
+	t.cs.DeleteClient(id)
+}
+
+func (t *clientTester) testUpdate() {
+	const id = "storagetest-update"
+	c := t.newClient(`{"client_id": "storagetest-update", "redirect_uris": ["https://client.example/cb"]}`)
+	if err := t.cs.UpdateClient(c); !errors.Is(err, jambo.ErrClientNotFound) {
+		t.errorf("UpdateClient(%q) before CreateClient: %v; want ErrClientNotFound", id, err)
+	}
+	t.checkClient("Update", id, nil)
+
+	if err := t.cs.CreateClient(c); err != nil {
+		t.errorf("CreateClient(%q): %v", id, err)
+		return
+	}
+	c = t.newClient(`{
+		"client_id": "storagetest-update",
+		"redirect_uris": ["https://client.example/cb", "https://client.example/cb2"],
+		"post_logout_redirect_uris": ["https://client.example/bye"]
+	}`)
+	if err := t.cs.UpdateClient(c); err != nil {
+		t.errorf("UpdateClient(%q): %v", id, err)
+	}
+	t.checkClient("Update", id, c)
+	if err := t.cs.UpdateClient(c); err != nil {
+		t.errorf("UpdateClient(%q) without changes: %v", id, err)
+	}
+	t.checkClient("Update without changes", id, c)
+	t.cs.DeleteClient(id)
+}
+
+func (t *clientTester) testDelete() {
+	const id = "storagetest-delete"
+	if err := t.cs.DeleteClient(id); !errors.Is(err, jambo.ErrClientNotFound) {
+		t.errorf("DeleteClient(%q) before CreateClient: %v; want ErrClientNotFound", id, err)
+	}
+	if err := t.cs.CreateClient(t.newClient(`{"client_id": "storagetest-delete"}`)); err != nil {
+		t.errorf("CreateClient(%q): %v", id, err)
+		return
+	}
+	if err := t.cs.DeleteClient(id); err != nil {
+		t.errorf("DeleteClient(%q): %v", id, err)
+	}
+	t.checkClient("Delete", id, nil)
+	if t.listed("Delete", id) {
+		t.errorf("Delete: Clients still returns %q", id)
+	}
+	if err := t.cs.DeleteClient(id); !errors.Is(err, jambo.ErrClientNotFound) {
+		t.errorf("DeleteClient(%q) twice: %v; want ErrClientNotFound", id, err)
+	}
+}
@@ -0,0 +1,219 @@
+// Package storagetest implements support for testing implementations of [jambo.Storage]
+// and [jambo.ClientStore].
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cespedes/jambo"
+)
+
+// TestStorage tests a [jambo.Storage] implementation.
+// It uses buckets whose names begin with "storagetest", which should be empty,
+// and it takes a little more than one second, to check the expiration of the values.
+// If TestStorage finds any misbehavior, it returns an error reporting all of them.
+//
+// Typical usage inside a test is:
+//
+//	if err := storagetest.TestStorage(st); err != nil {
+//		t.Fatal(err)
+//	}
+func TestStorage(st jambo.Storage) error {
+	t := &tester{st: st}
+	t.testPut()
+	t.testCreate()
+	t.testTake()
+	t.testDelete()
+	t.testList()
+	t.testExpiration()
+	t.testConcurrentTake()
+	return errors.Join(t.errs...)
+}
+
+type tester struct {
+	st   jambo.Storage
+	errs []error
+}
+
+func (t *tester) errorf(format string, args ...any) {
+	t.errs = append(t.errs, fmt.Errorf(format, args...))
+}
+
+// checkGet checks that a key has a given value, or does not exist if want is nil.
+func (t *tester) checkGet(op, bucket, key string, want []byte) {
+	got, err := t.st.Get(bucket, key)
+	switch {
+	case want == nil && !errors.Is(err, jambo.ErrNotFound):
+		t.errorf("%s: Get(%q, %q) = %q, %v; want ErrNotFound", op, bucket, key, got, err)
+	case want != nil && err != nil:
+		t.errorf("%s: Get(%q, %q): %v", op, bucket, key, err)
+	case want != nil && !bytes.Equal(got, want):
+		t.errorf("%s: Get(%q, %q) = %q; want %q", op, bucket, key, got, want)
+	}
+}
+
+func (t *tester) testPut() {
+	const bucket = "storagetest-put"
+	expires := time.Now().Add(time.Hour)
+
+	if err := t.st.Put(bucket, "a", []byte("1"), expires); err != nil {
+		t.errorf("Put: %v", err)
+		return
+	}
+	t.checkGet("Put", bucket, "a", []byte("1"))
+	t.checkGet("Put", bucket, "b", nil)
+	t.checkGet("Put", bucket+"-other", "a", nil)
+
+	if err := t.st.Put(bucket, "a", []byte("2"), expires); err != nil {
+		t.errorf("Put (replace): %v", err)
+	}
+	t.checkGet("Put (replace)", bucket, "a", []byte("2"))
+
+	// Modifying the slices must not modify the stored values.
+	value := []byte("3")
+	t.st.Put(bucket, "b", value, expires)
+	value[0] = 'x'
+	t.checkGet("Put (modified slice)", bucket, "b", []byte("3"))
+	if got, err := t.st.Get(bucket, "b"); err == nil && len(got) > 0 {
+		got[0] = 'x'
+		t.checkGet("Get (modified slice)", bucket, "b", []byte("3"))
+	}
+
+	if err := t.st.Put(bucket, "empty", nil, expires); err != nil {
+		t.errorf("Put (empty value): %v", err)
+	}
+	if _, err := t.st.Get(bucket, "empty"); err != nil {
+		t.errorf("Put (empty value): Get: %v", err)
+	}
+}
+
+func (t *tester) testCreate() {
+	const bucket = "storagetest-create"
+	expires := time.Now().Add(time.Hour)
+
+	if err := t.st.Create(bucket, "a", []byte("1"), expires); err != nil {
+		t.errorf("Create: %v", err)
+	}
+	if err := t.st.Create(bucket, "a", []byte("2"), expires); !errors.Is(err, jambo.ErrAlreadyExists) {
+		t.errorf("Create (existing key): got %v; want ErrAlreadyExists", err)
+	}
+	t.checkGet("Create (existing key)", bucket, "a", []byte("1"))
+
+	t.st.Put(bucket, "b", []byte("1"), time.Now().Add(-time.Second))
+	if err := t.st.Create(bucket, "b", []byte("2"), expires); err != nil {
+		t.errorf("Create (expired key): %v", err)
+	}
+	t.checkGet("Create (expired key)", bucket, "b", []byte("2"))
+}
+
+func (t *tester) testTake() {
+	const bucket = "storagetest-take"
+	expires := time.Now().Add(time.Hour)
+
+	t.st.Put(bucket, "a", []byte("1"), expires)
+	got, err := t.st.Take(bucket, "a")
+	if err != nil || !bytes.Equal(got, []byte("1")) {
+		t.errorf("Take = %q, %v; want %q", got, err, "1")
+	}
+	t.checkGet("Take", bucket, "a", nil)
+	if got, err := t.st.Take(bucket, "a"); !errors.Is(err, jambo.ErrNotFound) {
+		t.errorf("Take (taken key) = %q, %v; want ErrNotFound", got, err)
+	}
+
+	t.st.Put(bucket, "b", []byte("1"), time.Now().Add(-time.Second))
+	if got, err := t.st.Take(bucket, "b"); !errors.Is(err, jambo.ErrNotFound) {
+		t.errorf("Take (expired key) = %q, %v; want ErrNotFound", got, err)
+	}
+}
+
+func (t *tester) testDelete() {
+	const bucket = "storagetest-delete"
+
+	t.st.Put(bucket, "a", []byte("1"), time.Now().Add(time.Hour))
+	if err := t.st.Delete(bucket, "a"); err != nil {
+		t.errorf("Delete: %v", err)
+	}
+	t.checkGet("Delete", bucket, "a", nil)
+	if err := t.st.Delete(bucket, "a"); err != nil {
+		t.errorf("Delete (missing key): %v", err)
+	}
+}
+
+func (t *tester) testList() {
+	const bucket = "storagetest-list"
+	expires := time.Now().Add(time.Hour)
+
+	values, err := t.st.List(bucket)
+	if err != nil || len(values) != 0 {
+		t.errorf("List (empty bucket) = %q, %v; want no values", values, err)
+	}
+
+	t.st.Put(bucket, "a", []byte("1"), expires)
+	t.st.Put(bucket, "b", []byte("2"), expires)
+	t.st.Put(bucket, "c", []byte("3"), time.Now().Add(-time.Second))
+	t.st.Put(bucket+"-other", "d", []byte("4"), expires)
+
+	values, err = t.st.List(bucket)
+	if err != nil {
+		t.errorf("List: %v", err)
+		return
+	}
+	want := map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+	if len(values) != len(want) {
+		t.errorf("List = %q; want %q", values, want)
+		return
+	}
+	for key, value := range want {
+		if !bytes.Equal(values[key], value) {
+			t.errorf("List = %q; want %q", values, want)
+			return
+		}
+	}
+}
+
+func (t *tester) testExpiration() {
+	const bucket = "storagetest-expiration"
+
+	t.st.Put(bucket, "a", []byte("1"), time.Now().Add(time.Second))
+	t.st.Put(bucket, "b", []byte("2"), time.Now().Add(time.Hour))
+	t.checkGet("Expiration (before)", bucket, "a", []byte("1"))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	t.checkGet("Expiration (after)", bucket, "a", nil)
+	t.checkGet("Expiration (after)", bucket, "b", []byte("2"))
+}
+
+func (t *tester) testConcurrentTake() {
+	const (
+		bucket = "storagetest-concurrent"
+		n      = 10
+	)
+
+	t.st.Put(bucket, "a", []byte("1"), time.Now().Add(time.Hour))
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		taken int
+	)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := t.st.Take(bucket, "a"); err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 1 {
+		t.errorf("concurrent Take: value taken %d times; want 1", taken)
+	}
+}
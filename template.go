@@ -7,11 +7,22 @@ import (
 )
 
 func (s *Server) template(w http.ResponseWriter, r *http.Request, name string, data map[string]string) {
-	dest := map[string]string{
+	dest := make(map[string]any, len(data))
+	for k, v := range data {
+		dest[k] = v
+	}
+	s.render(w, r, name, dest)
+}
+
+// render is like template, but it allows any kind of data (such as lists) to be sent.
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, data map[string]any) {
+	dest := map[string]any{
 		"root":   s.root,
 		"issuer": s.issuer,
 	}
-	maps.Copy(dest, s.templateArgs)
+	for k, v := range s.templateArgs {
+		dest[k] = v
+	}
 	maps.Copy(dest, data)
 
 	if conn := s.GetConnection(r); conn != nil && conn.client != nil {
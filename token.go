@@ -1,118 +1,120 @@
 package jambo
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"slices"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
 	"github.com/iancoleman/orderedmap"
 )
 
+// Values for the "grant_type" parameter:
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+)
+
 func (s *Server) openIDToken(w http.ResponseWriter, r *http.Request) {
 	grantType := r.PostFormValue("grant_type")
-	if grantType != "authorization_code" {
+	if grantType != grantTypeAuthorizationCode && grantType != grantTypeRefreshToken {
 		if _DEBUG {
 			log.Printf("%s POST /token: unsupported grant_type %q\n", r.RemoteAddr, grantType)
 		}
-		fmt.Fprintln(w, `{"error":"unsupported_grant_type"}`)
-		return
-	}
-	code := r.PostFormValue("code")
-	if code == "" {
-		if _DEBUG {
-			log.Printf("%s POST /token: empty code\n", r.RemoteAddr)
-		}
-		fmt.Fprintln(w, `{"error":"invalid_request","error_description":"Required param: code."}`)
+		writeJSONError(w, http.StatusBadRequest, "unsupported_grant_type", "")
 		return
 	}
-	redirectURI := r.PostFormValue("redirect_uri")
 
-	// client_id and client_secret can be sent using HTTP Basic Authentication per RFC 6749, section 2.3.1
-	clientID, clientSecret, ok := r.BasicAuth()
-	if ok {
-		var err error
-		if clientID, err = url.QueryUnescape(clientID); err != nil {
-			if _DEBUG {
-				log.Printf("%s POST /token: invalid client_id\n", r.RemoteAddr)
-			}
-			fmt.Fprintln(w, `{"error":"invalid_request","error_description":"client_id improperly encoded"}`)
-			return
-		}
-		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
-			if _DEBUG {
-				log.Printf("%s POST /token: invalid client_secret\n", r.RemoteAddr)
-			}
-			fmt.Fprintln(w, `{"error":"invalid_request","error_description":"client_secret improperly encoded"}`)
-			return
-		}
-	} else {
-		clientID = r.PostFormValue("client_id")
-		clientSecret = r.PostFormValue("client_secret")
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
 	}
 
-	var client *Client
-	for _, c := range s.clients {
-		if c.id == clientID && c.secret == clientSecret {
-			client = c
-			break
-		}
+	// The access tokens may be bound to the client certificate or to a DPoP key.
+	jkt, err := s.checkDPoPProof(r, "")
+	if errors.Is(err, errUseDPoPNonce) {
+		s.newDPoPNonce(w)
+		writeJSONError(w, http.StatusBadRequest, "use_dpop_nonce", "Authorization server requires nonce in DPoP proof.")
+		return
 	}
-
-	if client == nil {
+	if err != nil {
 		if _DEBUG {
-			log.Printf("%s POST /token: unknown client_id=%q client_secret=%q\n", r.RemoteAddr, clientID, clientSecret)
+			log.Printf("%s POST /token: invalid DPoP proof: %v\n", r.RemoteAddr, err)
 		}
-		fmt.Fprintln(w, `{"error":"invalid_client","error_description":"Invalid client credentials."}`)
+		writeJSONError(w, http.StatusBadRequest, "invalid_dpop_proof", "Invalid DPoP proof.")
+		return
+	}
+	cnf, err := s.confirmation(client, r, jkt)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", err.Error())
 		return
 	}
 
-	s.Lock()
-	conn, ok := s.connections[code]
-	s.Unlock()
-
-	if !ok {
-		if _DEBUG {
-			log.Printf("%s POST /token: invalid code=%q\n", r.RemoteAddr, code)
+	// refresh is the connection used to issue a new refresh token, if any.
+	var conn, refresh *Connection
+	switch grantType {
+	case grantTypeAuthorizationCode:
+		conn = s.codeGrant(w, r, client)
+		if conn != nil && slices.Contains(conn.scopes, scopeOfflineAccess) {
+			refresh = conn
+			refresh.dpopJKT = jkt
 		}
-		fmt.Fprintln(w, `{"error":"invalid_grant","error_description":"Invalid or expired code parameter."}`)
+	case grantTypeRefreshToken:
+		conn, refresh = s.refreshGrant(w, r, client, jkt)
+	}
+	if conn == nil {
 		return
 	}
 
-	if redirectURI != conn.redirectURI {
-		if _DEBUG {
-			log.Printf("%s POST /token: invalid redirect_uri=%q\n", r.RemoteAddr, redirectURI)
-		}
-		fmt.Fprintln(w, `{"error":"invalid_request","error_description":"redirect_uri did not match URI from initial request."}`)
+	// The access token may be issued for some protected resources (RFC 8707).
+	resources, err := s.tokenResources(conn, r.PostForm["resource"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_target", err.Error())
 		return
 	}
+	scopes := s.resourceScopes(conn, resources)
 
-	idToken, err := s.getIDToken(&conn)
+	accessToken, lifetime, err := s.getAccessToken(conn, cnf, resources, scopes)
+	if err != nil {
+		http.Error(w, "Internal server error getting access token.", http.StatusInternalServerError)
+		return
+	}
+	idToken, err := s.getIDToken(conn, "", accessToken)
 	if err != nil {
 		http.Error(w, "Internal server error getting ID token.", http.StatusInternalServerError)
 		return
 	}
-	response := map[string]string{
-		"access_token": idToken, // this is used by "/userinfo" to return the claims
-		"token_type":   "Bearer",
+	s.sessionAddClient(conn.sid, conn.client.id)
+	tokenType := "Bearer"
+	if jkt != "" {
+		tokenType = tokenTypeDPoP
+		if s.dpopNonceRequired {
+			s.newDPoPNonce(w)
+		}
+	}
+	response := map[string]any{
+		"access_token": accessToken, // this is used by "/userinfo" to return the claims
+		"token_type":   tokenType,
 		"id_token":     idToken,
-		// "expires_in": // optional
-		// "refresh_token": // optional
-		// "scope": // optional
+		"expires_in":   int(lifetime.Seconds()),
+		"scope":        strings.Join(scopes, " "),
 	}
-
-	data, err := json.MarshalIndent(response, "", "  ")
-	if err != nil {
-		http.Error(w, "Internal server error marshaling keys.", http.StatusInternalServerError)
-		return
+	if refresh != nil {
+		refreshToken, err := s.newRefreshToken(refresh)
+		if err != nil {
+			http.Error(w, "Internal server error getting refresh token.", http.StatusInternalServerError)
+			return
+		}
+		response["refresh_token"] = refreshToken
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)+1))
 
 	// RFC6749 section 5.1:
 	// The authorization server MUST include the HTTP "Cache-Control"
@@ -120,25 +122,61 @@ func (s *Server) openIDToken(w http.ResponseWriter, r *http.Request) {
 	// response containing tokens, credentials, or other sensitive
 	// information, as well as the "Pragma" response header field [RFC2616]
 	// with a value of "no-cache"
-	w.Header().Set("Cache-Control", "no-store")
-	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, response)
+}
+
+// codeGrant returns the connection of the authorization code sent to the token endpoint,
+// removing it so it cannot be used again.  If it is not valid, it sends an error response
+// and returns nil.
+func (s *Server) codeGrant(w http.ResponseWriter, r *http.Request, client *Client) *Connection {
+	code := r.PostFormValue("code")
+	if code == "" {
+		if _DEBUG {
+			log.Printf("%s POST /token: empty code\n", r.RemoteAddr)
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid_request", "Required param: code.")
+		return nil
+	}
+	redirectURI := r.PostFormValue("redirect_uri")
+
+	conn := s.loadConnection(code)
+	if conn == nil || !conn.authorized || conn.client.id != client.id || s.takeConnection(code) == nil {
+		if _DEBUG {
+			log.Printf("%s POST /token: invalid code=%q\n", r.RemoteAddr, code)
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired code parameter.")
+		return nil
+	}
 
-	fmt.Fprintln(w, string(data))
+	if redirectURI != conn.redirectURI {
+		if _DEBUG {
+			log.Printf("%s POST /token: invalid redirect_uri=%q\n", r.RemoteAddr, redirectURI)
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri did not match URI from initial request.")
+		return nil
+	}
+	return conn
 }
 
 // https://openid.net/specs/openid-connect-core-1_0.html#rfc.section.2
 type IDToken struct {
 	// Standard claims:
-	Issuer            string `json:"iss"`
-	SubjectIdentifier string `json:"sub"`
-	Audience          string `json:"aud"`
-	Expiration        int64  `json:"exp"`
-	IssuedAt          int64  `json:"iat"`
-	Nonce             string `json:"nonce,omitempty"`
-	PreferredUsername string `json:"preferred_username,omitempty"`
-	Name              string `json:"name,omitempty"`
-	Email             string `json:"email,omitempty"`
-	EmailVerified     bool   `json:"email_verified,omitempty"`
+	Issuer            string   `json:"iss"`
+	SubjectIdentifier string   `json:"sub"`
+	Audience          string   `json:"aud"`
+	Expiration        int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	AuthTime          int64    `json:"auth_time,omitempty"`
+	Nonce             string   `json:"nonce,omitempty"`
+	ACR               string   `json:"acr,omitempty"`
+	AMR               []string `json:"amr,omitempty"`
+	SessionID         string   `json:"sid,omitempty"`
+	AccessTokenHash   string   `json:"at_hash,omitempty"`
+	CodeHash          string   `json:"c_hash,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     bool     `json:"email_verified,omitempty"`
 
 	// Other claims:
 	Claims map[string]any
@@ -152,9 +190,27 @@ func (idt IDToken) MarshalJSON() ([]byte, error) {
 	om.Set("aud", idt.Audience)
 	om.Set("exp", idt.Expiration)
 	om.Set("iat", idt.IssuedAt)
+	if idt.AuthTime != 0 {
+		om.Set("auth_time", idt.AuthTime)
+	}
 	if idt.Nonce != "" {
 		om.Set("nonce", idt.Nonce)
 	}
+	if idt.ACR != "" {
+		om.Set("acr", idt.ACR)
+	}
+	if len(idt.AMR) > 0 {
+		om.Set("amr", idt.AMR)
+	}
+	if idt.SessionID != "" {
+		om.Set("sid", idt.SessionID)
+	}
+	if idt.AccessTokenHash != "" {
+		om.Set("at_hash", idt.AccessTokenHash)
+	}
+	if idt.CodeHash != "" {
+		om.Set("c_hash", idt.CodeHash)
+	}
 	if idt.PreferredUsername != "" {
 		om.Set("preferred_username", idt.PreferredUsername)
 	}
@@ -174,44 +230,200 @@ func (idt IDToken) MarshalJSON() ([]byte, error) {
 	return json.Marshal(om)
 }
 
-func (s *Server) getIDToken(conn *Connection) (jws string, err error) {
-	signingKey := jose.SigningKey{Key: s.key, Algorithm: jose.RS256}
+// accessTokenLifetime is the time an access token is valid.
+const accessTokenLifetime = 1 * time.Hour
+
+// accessTokenJWTType is the "typ" of the access tokens (RFC 9068), which
+// tells them apart from the other JWTs signed by the server, such as ID tokens.
+const accessTokenJWTType = "at+jwt"
+
+// An AccessToken is the payload of the access tokens issued by the server.
+// It contains the claims to be returned by the userinfo endpoint.
+type AccessToken struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        jwt.Audience `json:"aud"`           // the client, or the requested resources
+	AuthorizedParty string       `json:"azp,omitempty"` // the client, if it is not the audience
+	Expiration      int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	ClientID        string       `json:"client_id"`
+	Scope           string       `json:"scope,omitempty"`
+	ID              string       `json:"jti"` // used to revoke the token
+
+	// Key the token is bound to, if any:
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// Claims returned by the userinfo endpoint (not in the tokens issued for API resources):
+	UserInfo map[string]any `json:"userinfo,omitempty"`
+}
+
+// sign returns the compact serialization of a JWS with the JSON encoding
+// of v as payload, signed with the server key.  If typ is not empty,
+// it is used as the "typ" header parameter.
+func (s *Server) sign(v any, typ string) (string, error) {
+	return s.signWithAlg(v, typ, jose.RS256)
+}
+
+// signWithAlg is like sign, but with a given algorithm, which must use an RSA key.
+func (s *Server) signWithAlg(v any, typ string, alg jose.SignatureAlgorithm) (string, error) {
+	signingKey := jose.SigningKey{Key: s.key, Algorithm: alg}
 
-	signer, err := jose.NewSigner(signingKey, &jose.SignerOptions{})
+	opts := &jose.SignerOptions{}
+	if typ != "" {
+		opts = opts.WithType(jose.ContentType(typ))
+	}
+	signer, err := jose.NewSigner(signingKey, opts)
 	if err != nil {
 		return "", fmt.Errorf("new signer: %v", err)
 	}
 
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signer.Sign(b)
+	if err != nil {
+		return "", fmt.Errorf("signing payload: %v", err)
+	}
+	return signature.CompactSerialize()
+}
+
+// verify checks the signature of a JWS issued by this server, and its "typ"
+// header parameter (which must be empty if typ is empty), so that a token cannot
+// be used as a token of another kind.  It stores its payload in the value pointed to by v.
+func (s *Server) verify(token, typ string, v any) error {
+	parsed, err := jose.ParseSigned(token, []jose.SignatureAlgorithm{jose.RS256})
+	if err != nil {
+		return err
+	}
+	header, _ := parsed.Signatures[0].Protected.ExtraHeaders[jose.HeaderType].(string)
+	if strings.TrimPrefix(strings.ToLower(header), "application/") != typ {
+		return fmt.Errorf(`invalid "typ" %q`, header)
+	}
+
+	payload, err := parsed.Verify(&s.key.Key.(*rsa.PrivateKey).PublicKey)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, v)
+}
+
+// parseIDTokenHint verifies an ID token previously issued by this server,
+// sent back by a client as a hint about the end-user.  Expired ID tokens are accepted.
+func (s *Server) parseIDTokenHint(token string) (*IDToken, error) {
+	var idToken IDToken
+	if err := s.verify(token, "", &idToken); err != nil {
+		return nil, fmt.Errorf("invalid id_token_hint: %w", err)
+	}
+	if idToken.Issuer != s.issuer {
+		return nil, fmt.Errorf("invalid id_token_hint: unknown issuer %q", idToken.Issuer)
+	}
+	// Other JWTs signed without "typ" (such as JARM responses) lack these claims.
+	if idToken.SubjectIdentifier == "" || idToken.Audience == "" || idToken.IssuedAt == 0 {
+		return nil, errors.New("invalid id_token_hint: not an ID token")
+	}
+	return &idToken, nil
+}
+
+// getIDToken returns an ID token for a connection.  If code or accessToken are not empty,
+// their hashes are included in the "c_hash" and "at_hash" claims.
+func (s *Server) getIDToken(conn *Connection, code, accessToken string) (jws string, err error) {
 	idToken := IDToken{
 		Issuer:            s.issuer,
 		SubjectIdentifier: conn.response.Login,
 		Audience:          conn.client.id,
 		Expiration:        time.Now().Unix() + 3600, // expires in 1 hour
 		IssuedAt:          time.Now().Unix(),
+		AuthTime:          conn.authTime.Unix(),
 		Nonce:             conn.nonce,
+		ACR:               conn.response.ACR,
+		AMR:               conn.response.AMR,
+		SessionID:         conn.sid,
 	}
-	if slices.Contains(conn.scopes, scopeProfile) {
+	if conn.wantClaim(claimsTargetIDToken, "name", conn.response.Name) {
 		idToken.Name = conn.response.Name
+	}
+	if conn.wantClaim(claimsTargetIDToken, "preferred_username", conn.response.Login) {
 		idToken.PreferredUsername = conn.response.Login
 	}
-	if slices.Contains(conn.scopes, scopeEmail) {
+	if conn.wantClaim(claimsTargetIDToken, "email", conn.response.Mail) {
 		idToken.Email = conn.response.Mail
-		if idToken.Email != "" {
-			idToken.EmailVerified = true
-		}
+	}
+	if conn.wantClaim(claimsTargetIDToken, "email_verified", true) && conn.response.Mail != "" {
+		idToken.EmailVerified = true
 	}
 
-	if len(conn.response.Claims) > 0 {
-		idToken.Claims = conn.response.Claims
+	if code != "" {
+		idToken.CodeHash = leftHash(code)
 	}
-	b, err := json.Marshal(idToken)
-	if err != nil {
-		return "", err
+	if accessToken != "" {
+		idToken.AccessTokenHash = leftHash(accessToken)
 	}
 
-	signature, err := signer.Sign(b)
-	if err != nil {
-		return "", fmt.Errorf("signing payload: %v", err)
+	idToken.Claims = conn.extraClaims(claimsTargetIDToken)
+	return s.sign(idToken, "")
+}
+
+// getAccessToken returns an access token for a connection, with some scopes,
+// and the time it is valid.  If it is issued for some API resources, they are
+// its audience, and their settings are used; otherwise, its audience is the client.
+func (s *Server) getAccessToken(conn *Connection, cnf *Confirmation, resources, scopes []string) (token string, lifetime time.Duration, err error) {
+	format, lifetime := s.accessTokenSettings(resources)
+	accessToken := AccessToken{
+		Issuer:     s.issuer,
+		Subject:    conn.response.Login,
+		Audience:   jwt.Audience{conn.client.id},
+		Expiration: time.Now().Add(lifetime).Unix(),
+		IssuedAt:   time.Now().Unix(),
+		ClientID:   conn.client.id,
+		Scope:      strings.Join(scopes, " "),
+		ID:         rand.Text(),
+
+		Confirmation: cnf,
 	}
-	return signature.CompactSerialize()
+	// The APIs only get the subject and the scopes, not the claims of the user.
+	if len(resources) > 0 {
+		accessToken.Audience = resources
+		accessToken.AuthorizedParty = conn.client.id
+	} else {
+		accessToken.UserInfo = conn.userClaims(claimsTargetUserInfo)
+	}
+
+	// Opaque access tokens are kept in the Storage, like the refresh tokens.
+	if format == TokenFormatOpaque {
+		data, err := json.Marshal(accessToken)
+		if err != nil {
+			return "", 0, err
+		}
+		token = rand.Text()
+		err = s.storage.Put(bucketAccessTokens, hashToken(token), data, time.Unix(accessToken.Expiration, 0))
+		if err != nil {
+			return "", 0, err
+		}
+		return token, lifetime, nil
+	}
+	token, err = s.sign(accessToken, accessTokenJWTType)
+	return token, lifetime, err
+}
+
+// parseAccessToken returns the content of an access token issued by this server:
+// a JWT signed by it, or an opaque token kept in the Storage.
+// Expired or revoked access tokens are not rejected.
+func (s *Server) parseAccessToken(token string) (*AccessToken, error) {
+	var accessToken AccessToken
+	if data, err := s.storage.Get(bucketAccessTokens, hashToken(token)); err == nil {
+		if err := json.Unmarshal(data, &accessToken); err != nil {
+			return nil, err
+		}
+		return &accessToken, nil
+	}
+	if err := s.verify(token, accessTokenJWTType, &accessToken); err != nil {
+		return nil, err
+	}
+	if accessToken.Issuer != s.issuer {
+		return nil, fmt.Errorf("unknown issuer %q", accessToken.Issuer)
+	}
+	return &accessToken, nil
 }
@@ -0,0 +1,64 @@
+package jambo_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// jwtHeader returns the header of a JWT.
+func jwtHeader(t *testing.T, token string) map[string]any {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestTokenTypes(t *testing.T) {
+	_, ts := newTestServer(t)
+	tokens := getTokens(t, ts, authParams(nil))
+	accessToken, _ := tokens["access_token"].(string)
+	idToken, _ := tokens["id_token"].(string)
+
+	if typ := jwtHeader(t, accessToken)["typ"]; typ != "at+jwt" {
+		t.Errorf(`access token "typ" = %v; want "at+jwt"`, typ)
+	}
+	if claims := getUserInfo(t, ts, accessToken); claims["sub"] != "alice" {
+		t.Errorf("userinfo with access token = %v; want sub alice", claims)
+	}
+	_, body := postForm(t, ts, "/introspect", url.Values{"token": {accessToken}})
+	if body["active"] != true {
+		t.Errorf("introspection of access token = %v; want active", body)
+	}
+
+	// An ID token cannot be used as an access token.
+	if claims := getUserInfo(t, ts, idToken); claims["sub"] != nil || claims["error"] == nil {
+		t.Errorf("userinfo with ID token = %v; want error", claims)
+	}
+	_, body = postForm(t, ts, "/introspect", url.Values{"token": {idToken}})
+	if body["active"] != false {
+		t.Errorf("introspection of ID token = %v; want inactive", body)
+	}
+
+	// An access token cannot be used as an ID token.
+	for name, hint := range map[string]string{"access token": accessToken, "ID token": idToken} {
+		resp, err := ts.Client().Get(ts.URL + "/oidc/logout?" + url.Values{"id_token_hint": {hint}}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := readBody(t, resp)
+		rejected := strings.Contains(page, "invalid id_token_hint")
+		if want := name != "ID token"; rejected != want || resp.StatusCode != http.StatusOK {
+			t.Errorf("logout with %s as id_token_hint: rejected = %v; want %v", name, rejected, want)
+		}
+	}
+}
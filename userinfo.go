@@ -1,32 +1,55 @@
 package jambo
 
 import (
-	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-
-	"github.com/go-jose/go-jose/v4"
+	"time"
 )
 
 func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
 	fields := strings.Fields(r.Header.Get("Authorization"))
-	if len(fields) != 2 || fields[0] != "Bearer" {
+	if len(fields) != 2 || (fields[0] != "Bearer" && fields[0] != tokenTypeDPoP) {
 		fmt.Fprintln(w, `{"error":"access_denied","error_description":"Invalid bearer token."}`)
 		return
 	}
 	token := fields[1]
 
-	parsed, err := jose.ParseSigned(token, []jose.SignatureAlgorithm{jose.RS256})
+	accessToken, err := s.parseAccessToken(token)
 	if err != nil {
-		fmt.Fprintf(w, `{"error":"access_denied","error_description1":%q}`+"\n", err.Error())
+		fmt.Fprintf(w, `{"error":"access_denied","error_description":%q}`+"\n", err.Error())
+		return
+	}
+	if accessToken.Expiration < time.Now().Unix() {
+		fmt.Fprintln(w, `{"error":"invalid_token","error_description":"Access token expired."}`)
+		return
+	}
+	// Access tokens issued for API resources cannot be used here.
+	if !accessToken.Audience.Contains(accessToken.ClientID) {
+		fmt.Fprintln(w, `{"error":"invalid_token","error_description":"Access token not issued for the userinfo endpoint."}`)
+		return
+	}
+	if !checkConfirmation(accessToken.Confirmation, r) {
+		fmt.Fprintln(w, `{"error":"invalid_token","error_description":"Access token bound to another certificate."}`)
+		return
+	}
+	if !s.checkDPoPBinding(w, r, fields[0], token, accessToken.Confirmation) {
+		return
+	}
+	if s.accessTokenRevoked(accessToken) {
+		fmt.Fprintln(w, `{"error":"invalid_token","error_description":"Access token revoked."}`)
 		return
 	}
 
-	data, err := parsed.Verify(&s.key.Key.(*rsa.PrivateKey).PublicKey)
+	claims := map[string]any{"sub": accessToken.Subject}
+	for k, v := range accessToken.UserInfo {
+		claims[k] = v
+	}
+	data, err := json.MarshalIndent(claims, "", "  ")
 	if err != nil {
-		fmt.Fprintf(w, `{"error":"access_denied","error_description2":%q}`+"\n", err.Error())
+		http.Error(w, "Internal server error marshaling claims.", http.StatusInternalServerError)
 		return
 	}
 